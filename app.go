@@ -1,20 +1,32 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	_ "github.com/go-sql-driver/mysql"
 	"github.com/kneu-messenger-pigeon/events"
+	_ "github.com/lib/pq"
 	_ "github.com/nakagami/firebirdsql"
 	"github.com/segmentio/kafka-go"
 	"io"
+	_ "modernc.org/sqlite"
 	"os"
+	"os/signal"
+	"slices"
+	"syscall"
 	"time"
 )
 
 const ExitCodeMainError = 1
 
-func runApp(out io.Writer) error {
+func runApp(out io.Writer, args []string) (err error) {
+	command, err := parseCommand(args)
+	if err != nil {
+		return err
+	}
+
 	envFilename := ""
 	if _, err := os.Stat(".env"); err == nil {
 		envFilename = ".env"
@@ -25,48 +37,176 @@ func runApp(out io.Writer) error {
 		return errors.New("Failed to load config: " + err.Error())
 	}
 
+	// drivers and writers may quote connection settings in errors, which are returned, logged and published
+	secrets := config.secretsReplacer()
+	defer func() {
+		err = redactError(err, secrets)
+	}()
+	out = &RedactingWriter{out: out, replacer: secrets}
+
+	if command.Name == ConfigCheckCommand {
+		config.print(out)
+		return nil
+	}
+
+	for _, warning := range config.warnings() {
+		fmt.Fprintf(out, "Warning: %s\n", warning)
+	}
+
+	var fingerprints *FingerprintStore
+	if config.fingerprintsFile != "" {
+		fingerprints, err = NewFingerprintStore(config.fingerprintsFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	// dry run must not change state of real runs
+	var checkpoints *CheckpointStore
+	if fingerprints != nil && config.dryRun {
+		fingerprints.readOnly = true
+	}
+	if config.checkpointsFile != "" && !config.dryRun {
+		checkpoints, err = NewCheckpointStore(config.checkpointsFile)
+		if err != nil {
+			return err
+		}
+	}
+
 	db, err := sql.Open(config.dekanatDbDriverName, config.secondaryDekanatDbDSN)
 	if err != nil {
 		return errors.New("Wrong connection configuration for secondary Dekanat DB: " + err.Error())
 	}
 
+	if config.queryFile != "" {
+		if err = config.query.check(db, config.dialect); err != nil {
+			_ = db.Close()
+			return errors.New("Wrong DISCIPLINES_QUERY_FILE for secondary Dekanat DB: " + err.Error())
+		}
+	}
+
+	if config.producer.transport, err = config.kafkaSecurity.newTransport(config.kafkaTimeout); err != nil {
+		_ = db.Close()
+		return errors.New("Wrong Kafka security configuration: " + err.Error())
+	}
+
+	var writer events.WriterInterface
+	var outbox *Outbox
+	if !config.dryRun {
+		// stdout sink owns out, so progress is logged into stderr
+		logOut := out
+		if slices.ContainsFunc(config.sinks, func(sink SinkConfig) bool { return sink.kind == StdoutSink }) {
+			logOut = &RedactingWriter{out: os.Stderr, replacer: secrets}
+		}
+		var spillKafka func(writer events.WriterInterface) (events.WriterInterface, error)
+		if config.outboxDir != "" {
+			spillKafka = func(writer events.WriterInterface) (events.WriterInterface, error) {
+				var err error
+				if outbox, err = NewOutbox(config.outboxDir, writer, config.outboxFlushInterval, logOut); err != nil {
+					return nil, errors.New("failed to open OUTBOX_DIR: " + err.Error())
+				}
+				outbox.start()
+				return outbox, nil
+			}
+		}
+		if writer, err = newSinksWriter(
+			config.sinks, config.kafkaBrokers, config.producer, out, logOut, config.writeRetry, config.batch, spillKafka,
+		); err != nil {
+			_ = db.Close()
+			return errors.New("Failed to create output sink: " + err.Error())
+		}
+		out = logOut
+	} else {
+		var records *JsonlWriter
+		if config.dryRunOutput != "" {
+			if records, err = NewJsonlFileWriter(config.dryRunOutput); err != nil {
+				_ = db.Close()
+				return errors.New("Failed to open DRY_RUN_OUTPUT: " + err.Error())
+			}
+		}
+		writer = NewDryRunWriter(out, records)
+	}
+
+	var deadLetter events.WriterInterface
+	if config.dryRun && (config.deadLetterFile != "" || config.deadLetterTopic != "") {
+		deadLetter = writer
+	} else if config.deadLetterFile != "" {
+		deadLetter, err = NewJsonlFileWriter(config.deadLetterFile)
+		if err != nil {
+			_ = writer.Close()
+			_ = db.Close()
+			return errors.New("Failed to open DEAD_LETTER_FILE: " + err.Error())
+		}
+	} else if config.deadLetterTopic != "" {
+		deadLetter = withRetries(config.producer.newWriter(config.kafkaBrokers, config.deadLetterTopic, out), config.writeRetry, out)
+	}
+
+	var lifecycle events.WriterInterface
+	if config.lifecycleEvents && config.dryRun {
+		lifecycle = writer
+	} else if config.lifecycleEvents {
+		lifecycle = withRetries(config.producer.newWriter(config.kafkaBrokers, config.lifecycleTopic, out), config.writeRetry, out)
+	}
+
 	importer := &Importer{
 		out:            out,
 		db:             db,
-		writeThreshold: 100,
-		writer: &kafka.Writer{
-			Addr:     kafka.TCP(config.kafkaHost),
-			Topic:    events.DisciplinesTopic,
-			Balancer: &kafka.LeastBytes{},
-		},
-	}
-
-	eventLoop := &EventLoop{
-		out:      out,
-		importer: importer,
-		reader: kafka.NewReader(
-			kafka.ReaderConfig{
-				Brokers:     []string{config.kafkaHost},
-				GroupID:     "secondary-db-disciplines-importer",
-				Topic:       events.MetaEventsTopic,
-				MinBytes:    10,
-				MaxBytes:    10e3,
-				MaxWait:     time.Second,
-				MaxAttempts: config.kafkaAttempts,
-				Dialer: &kafka.Dialer{
-					Timeout:   config.kafkaTimeout,
-					DualStack: kafka.DefaultDialer.DualStack,
-				},
-			},
-		),
+		batch:          config.batch,
+		keyMode:        config.keyMode,
+		fingerprints:   fingerprints,
+		force:          config.forceImport,
+		payloadVersion: config.payloadVersion,
+		query:          config.query,
+		dialect:        config.dialect,
+		normalizer:     config.nameNormalizer,
+		keepRawName:    config.keepRawName,
+		deadLetter:     deadLetter,
+		maxInvalidRows: config.maxInvalidRows,
+		checkpoints:    checkpoints,
+		writer:         writer,
+		lifecycle:      lifecycle,
+		sourceDb:       config.sourceDbIdentity,
+		tracing:        config.tracing,
+		outbox:         outbox,
+		secrets:        secrets,
 	}
 
 	defer func() {
-		_ = eventLoop.reader.Close()
 		_ = importer.writer.Close()
+		if deadLetter != nil && deadLetter != importer.writer {
+			_ = deadLetter.Close()
+		}
+		if lifecycle != nil && lifecycle != importer.writer {
+			_ = lifecycle.Close()
+		}
 		_ = db.Close()
 	}()
 
+	if command.Name != ServeCommand {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+		defer stop()
+
+		fmt.Fprintf(
+			out, "Import %d disciplines from %s to %s \n", command.Task.Year,
+			command.Task.StartDatetime.Format(dateFormat), command.Task.EndDatetime.Format(dateFormat),
+		)
+		return importer.execute(ctx, command.Task)
+	}
+
+	dialer, err := config.kafkaSecurity.newDialer(config.kafkaTimeout)
+	if err != nil {
+		return errors.New("Wrong Kafka security configuration: " + err.Error())
+	}
+
+	eventLoop := &EventLoop{
+		out:      out,
+		importer: importer,
+		dryRun:   config.dryRun,
+		reload:   (&ConfigReloader{out: out, config: config, importer: importer}).reload,
+		reader:   kafka.NewReader(config.metaEventsReaderConfig(dialer)),
+	}
+	defer eventLoop.reader.Close()
+
 	return eventLoop.execute()
 }
 
@@ -75,9 +215,35 @@ func handleExitError(errStream io.Writer, err error) int {
 		fmt.Fprintln(errStream, err)
 	}
 
+	var usageError UsageError
+	if errors.As(err, &usageError) {
+		fmt.Fprintln(errStream, usage)
+		return ExitCodeUsageError
+	}
+
 	if err != nil {
 		return ExitCodeMainError
 	}
 
 	return 0
 }
+
+// metaEventsReaderConfig describes reader of meta events; consumer group of dry run never commits, so it starts
+// from the latest meta events instead of replaying the whole topic with full-year imports.
+func (config Config) metaEventsReaderConfig(dialer *kafka.Dialer) kafka.ReaderConfig {
+	readerConfig := kafka.ReaderConfig{
+		Brokers:     config.kafkaBrokers,
+		GroupID:     config.consumerGroupId,
+		Topic:       config.metaEventsTopic,
+		MinBytes:    10,
+		MaxBytes:    10e3,
+		MaxWait:     time.Second,
+		MaxAttempts: config.kafkaAttempts,
+		Dialer:      dialer,
+	}
+	if config.dryRun {
+		readerConfig.StartOffset = kafka.LastOffset
+	}
+
+	return readerConfig
+}
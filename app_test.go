@@ -2,9 +2,12 @@ package main
 
 import (
 	"bytes"
+	"database/sql"
 	"errors"
+	"github.com/segmentio/kafka-go"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -40,20 +43,21 @@ func TestRunApp(t *testing.T) {
 		_ = os.Setenv("KAFKA_ATTEMPTS", "1")
 
 		var out bytes.Buffer
-		err := runApp(&out)
+		err := runApp(&out, nil)
 
 		assert.Error(t, err, "Expected for error, got %s")
 		assert.ErrorContains(t, err, "failed to dial: failed to open connection t")
+		assert.Contains(t, out.String(), "Warning: retried writes may publish duplicates")
 	})
 
 	t.Run("Run with wrong sql driver", func(t *testing.T) {
 		_ = os.Setenv("DEKANAT_DB_DRIVER_NAME", "dummy-not-exist")
-		_ = os.Setenv("KAFKA_HOST", expectedConfig.kafkaHost)
+		_ = os.Setenv("KAFKA_HOST", strings.Join(expectedConfig.kafkaBrokers, ","))
 		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", expectedConfig.secondaryDekanatDbDSN)
 		defer os.Unsetenv("DEKANAT_DB_DRIVER_NAME")
 
 		var out bytes.Buffer
-		err := runApp(&out)
+		err := runApp(&out, nil)
 
 		expectedError := "Wrong connection configuration for secondary Dekanat DB: sql: unknown driver \"dummy-not-exist\" (forgotten import?)"
 
@@ -61,6 +65,147 @@ func TestRunApp(t *testing.T) {
 		assert.Equalf(t, expectedError, err.Error(), "Expected for another error, got %s", err)
 	})
 
+	t.Run("Run with broken fingerprints file", func(t *testing.T) {
+		fingerprintsFile := tmpDir + "/fingerprints.json"
+		_ = os.WriteFile(fingerprintsFile, []byte("{broken"), os.ModePerm)
+		defer os.Remove(fingerprintsFile)
+
+		_ = os.Setenv("KAFKA_HOST", strings.Join(expectedConfig.kafkaBrokers, ","))
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", expectedConfig.secondaryDekanatDbDSN)
+		_ = os.Setenv("FINGERPRINTS_FILE", fingerprintsFile)
+		defer os.Unsetenv("FINGERPRINTS_FILE")
+
+		var out bytes.Buffer
+		err := runApp(&out, nil)
+
+		assert.Error(t, err, "Expected for error")
+		assert.ErrorContains(t, err, "Failed to parse fingerprints file")
+	})
+
+	t.Run("Run config check", func(t *testing.T) {
+		_ = os.Setenv("KAFKA_HOST", strings.Join(expectedConfig.kafkaBrokers, ","))
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", expectedConfig.secondaryDekanatDbDSN)
+
+		var out bytes.Buffer
+		err := runApp(&out, []string{"config", "check"})
+
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), "KAFKA_HOST=KAFKA:9999\n")
+		assert.Contains(t, out.String(), "SECONDARY_DEKANAT_DB_DSN=USER:*****@HOST/DATABASE\n")
+		assert.NotContains(t, out.String(), "PASSOWORD")
+
+		_ = os.Setenv("KAFKA_TIMEOUT", "abc")
+		defer os.Unsetenv("KAFKA_TIMEOUT")
+
+		err = runApp(&out, []string{"config", "check"})
+		assert.EqualError(
+			t, err,
+			`Failed to load config: wrong KAFKA_TIMEOUT: time: invalid duration "abc", expected duration like "10s" or number of seconds`,
+		)
+	})
+
+	t.Run("Run with redacted connection error", func(t *testing.T) {
+		_ = os.Setenv("DEKANAT_DB_DRIVER_NAME", "postgres")
+		_ = os.Setenv("KAFKA_HOST", strings.Join(expectedConfig.kafkaBrokers, ","))
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "postgres://importer:s3cret@db:port/dekanat")
+		_ = os.Setenv("DRY_RUN", "true")
+		defer os.Unsetenv("DEKANAT_DB_DRIVER_NAME")
+		defer os.Unsetenv("DRY_RUN")
+
+		var out bytes.Buffer
+		err := runApp(&out, []string{"import", "--from", "2023-03-05", "--to", "2023-03-06", "--year", "2022"})
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "postgres://importer:*****@db:port/dekanat")
+		assert.NotContains(t, err.Error(), "s3cret")
+	})
+
+	t.Run("Run with redacted webhook token", func(t *testing.T) {
+		dbFile := tmpDir + "/dekanat-webhook.sqlite"
+		defer os.Remove(dbFile)
+
+		db, err := sql.Open("sqlite", dbFile)
+		assert.NoError(t, err)
+		_, err = db.Exec(`
+			CREATE TABLE TPR_COLL (ID INTEGER PRIMARY KEY, PREDMET TEXT);
+			CREATE TABLE T_PD_CMS (ID INTEGER PRIMARY KEY, PREDM_ID INTEGER, REGDATE TEXT);
+			INSERT INTO TPR_COLL VALUES (1, 'name 10');
+			INSERT INTO T_PD_CMS VALUES (10, 1, '2023-03-05 04:00:00');
+		`)
+		assert.NoError(t, err)
+		_ = db.Close()
+
+		_ = os.Setenv("DEKANAT_DB_DRIVER_NAME", "sqlite")
+		_ = os.Setenv("KAFKA_HOST", strings.Join(expectedConfig.kafkaBrokers, ","))
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", dbFile)
+		_ = os.Setenv("OUTPUT_SINKS", "webhook")
+		_ = os.Setenv("OUTPUT_WEBHOOK_URL", "http://127.0.0.1:1/in?token=S3CRETTOKEN")
+		_ = os.Setenv("OUTPUT_WEBHOOK_ATTEMPTS", "1")
+		_ = os.Setenv("WRITE_RETRY_MAX_DURATION", "0")
+		defer os.Unsetenv("DEKANAT_DB_DRIVER_NAME")
+		defer os.Unsetenv("OUTPUT_SINKS")
+		defer os.Unsetenv("OUTPUT_WEBHOOK_URL")
+		defer os.Unsetenv("OUTPUT_WEBHOOK_ATTEMPTS")
+		defer os.Unsetenv("WRITE_RETRY_MAX_DURATION")
+
+		var out bytes.Buffer
+		err = runApp(&out, []string{"config", "check"})
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), "OUTPUT_WEBHOOK_URL=http://127.0.0.1:1/in?*****\n")
+
+		out.Reset()
+		err = runApp(&out, []string{"import", "--from", "2023-03-05", "--to", "2023-03-06", "--year", "2022"})
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `"http://127.0.0.1:1/in?*****"`)
+		assert.NotContains(t, err.Error(), "S3CRETTOKEN")
+		assert.Contains(t, out.String(), "Error: ")
+		assert.NotContains(t, out.String(), "S3CRETTOKEN")
+	})
+
+	t.Run("Run with wrong command", func(t *testing.T) {
+		var out bytes.Buffer
+		err := runApp(&out, []string{"import-year"})
+
+		assert.Equal(t, UsageError{"import-year: expected one YEAR argument"}, err)
+	})
+
+	t.Run("Run import command in dry run", func(t *testing.T) {
+		dbFile := tmpDir + "/dekanat.sqlite"
+		defer os.Remove(dbFile)
+
+		db, err := sql.Open("sqlite", dbFile)
+		assert.NoError(t, err)
+		_, err = db.Exec(`
+			CREATE TABLE TPR_COLL (ID INTEGER PRIMARY KEY, PREDMET TEXT);
+			CREATE TABLE T_PD_CMS (ID INTEGER PRIMARY KEY, PREDM_ID INTEGER, REGDATE TEXT);
+			INSERT INTO TPR_COLL VALUES (1, 'name 10'), (2, 'name 11');
+			INSERT INTO T_PD_CMS VALUES (10, 1, '2023-03-05 04:00:00'), (11, 2, '2023-03-07 04:00:00');
+		`)
+		assert.NoError(t, err)
+		_ = db.Close()
+
+		_ = os.Setenv("DEKANAT_DB_DRIVER_NAME", "sqlite")
+		_ = os.Setenv("KAFKA_HOST", strings.Join(expectedConfig.kafkaBrokers, ","))
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", dbFile)
+		_ = os.Setenv("DRY_RUN", "true")
+		_ = os.Setenv("LIFECYCLE_EVENTS", "true")
+		defer os.Unsetenv("DEKANAT_DB_DRIVER_NAME")
+		defer os.Unsetenv("DRY_RUN")
+		defer os.Unsetenv("LIFECYCLE_EVENTS")
+
+		var out bytes.Buffer
+		err = runApp(&out, []string{"import", "--from", "2023-03-05", "--to", "2023-03-06", "--year", "2022"})
+
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), "Import 2022 disciplines from 2023-03-05 00:00:00 to 2023-03-06 00:00:00")
+		assert.Contains(t, out.String(), `"Name": "name 10"`)
+		assert.NotContains(t, out.String(), `"Name": "name 11"`)
+		assert.Contains(t, out.String(), `"key": "DisciplinesImportStarted"`)
+		assert.Contains(t, out.String(), "Dry run: 3 messages would be published"+
+			" (DisciplineEvent: 1, DisciplinesImportFinished: 1, DisciplinesImportStarted: 1)")
+	})
+
 	t.Run("Run with wrong env file", func(t *testing.T) {
 		_ = os.Setenv("DEKANAT_DB_DRIVER_NAME", "")
 		_ = os.Setenv("KAFKA_HOST", "")
@@ -76,7 +221,7 @@ func TestRunApp(t *testing.T) {
 		}
 
 		var out bytes.Buffer
-		err := runApp(&out)
+		err := runApp(&out, nil)
 		assert.Error(t, err, "Expected for error")
 		assert.Containsf(
 			t, err.Error(), "Failed to load config",
@@ -92,6 +237,7 @@ func TestHandleExitError(t *testing.T) {
 
 		testCases := map[error]int{
 			errors.New("dummy error"): ExitCodeMainError,
+			UsageError{"dummy usage"}: ExitCodeUsageError,
 			nil:                       0,
 		}
 
@@ -112,3 +258,15 @@ func TestHandleExitError(t *testing.T) {
 		}
 	})
 }
+
+func TestMetaEventsReaderConfig(t *testing.T) {
+	config := expectedConfig
+	readerConfig := config.metaEventsReaderConfig(nil)
+
+	assert.Equal(t, config.consumerGroupId, readerConfig.GroupID)
+	assert.Equal(t, config.metaEventsTopic, readerConfig.Topic)
+	assert.Equal(t, int64(0), readerConfig.StartOffset, "zero start offset means kafka.FirstOffset")
+
+	config.dryRun = true
+	assert.Equal(t, kafka.LastOffset, config.metaEventsReaderConfig(nil).StartOffset)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/binary"
+	"github.com/segmentio/kafka-go"
+	"time"
+)
+
+// BatchPolicy flushes batch on whichever comes first of message count, total bytes or linger time;
+// zero maxBytes and linger disable the corresponding limit.
+type BatchPolicy struct {
+	maxCount int
+	maxBytes int
+	linger   time.Duration
+}
+
+const (
+	FlushByCount  = "count"
+	FlushByBytes  = "bytes"
+	FlushByLinger = "linger"
+	FlushByEnd    = "end"
+)
+
+type BatchStats struct {
+	Batches  int
+	Messages int
+	Bytes    int
+	// MaxBatchBytes is size of the largest written batch
+	MaxBatchBytes int
+	ByCount       int
+	ByBytes       int
+	ByLinger      int
+	ByEnd         int
+}
+
+type Batch struct {
+	policy    BatchPolicy
+	messages  []kafka.Message
+	bytes     int
+	startedAt time.Time
+	stats     BatchStats
+}
+
+// recordOverhead is size of CRC, magic byte, attributes, key and value lengths and timestamp of message.
+const recordOverhead = 4 + 1 + 1 + 4 + 4 + 8
+
+// messageSize is size of message as kafka.Writer counts it against BatchBytes, so batch of maxBytes is written
+// by writer as a single batch.
+func messageSize(message kafka.Message) int {
+	size := recordOverhead + len(message.Key) + len(message.Value) + varintSize(len(message.Headers))
+	for _, header := range message.Headers {
+		size += varintSize(len(header.Key)) + len(header.Key) + varintSize(len(header.Value)) + len(header.Value)
+	}
+
+	return size
+}
+
+func varintSize(value int) int {
+	return len(binary.AppendVarint(nil, int64(value)))
+}
+
+func (batch *Batch) len() int {
+	return len(batch.messages)
+}
+
+// fits reports whether message can be added without exceeding maxBytes; an empty batch fits any message.
+func (batch *Batch) fits(message kafka.Message) bool {
+	return batch.policy.maxBytes == 0 || len(batch.messages) == 0 || batch.bytes+messageSize(message) <= batch.policy.maxBytes
+}
+
+func (batch *Batch) add(message kafka.Message, now time.Time) {
+	if len(batch.messages) == 0 {
+		batch.startedAt = now
+	}
+
+	batch.messages = append(batch.messages, message)
+	batch.bytes += messageSize(message)
+}
+
+// flushReason returns why not empty batch should be flushed now or empty string.
+func (batch *Batch) flushReason(now time.Time) string {
+	if len(batch.messages) == 0 {
+		return ""
+	}
+
+	if len(batch.messages) >= batch.policy.maxCount {
+		return FlushByCount
+	}
+
+	if batch.policy.linger != 0 && now.Sub(batch.startedAt) >= batch.policy.linger {
+		return FlushByLinger
+	}
+
+	return ""
+}
+
+// take returns batch messages for writing and counts the flush in stats.
+func (batch *Batch) take(reason string) []kafka.Message {
+	messages := batch.messages
+
+	batch.stats.Batches++
+	batch.stats.Messages += len(messages)
+	batch.stats.Bytes += batch.bytes
+	batch.stats.MaxBatchBytes = max(batch.stats.MaxBatchBytes, batch.bytes)
+	switch reason {
+	case FlushByCount:
+		batch.stats.ByCount++
+	case FlushByBytes:
+		batch.stats.ByBytes++
+	case FlushByLinger:
+		batch.stats.ByLinger++
+	default:
+		batch.stats.ByEnd++
+	}
+
+	batch.messages = nil
+	batch.bytes = 0
+
+	return messages
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMessageSize(t *testing.T) {
+	message := kafka.Message{
+		Key:     []byte("2030-10"),
+		Value:   []byte("{}"),
+		Headers: []kafka.Header{{Key: "event", Value: []byte("a")}},
+	}
+	assert.Equal(t, 40, messageSize(message))
+
+	// writer rejects too large message before it connects to broker
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	writer := &kafka.Writer{Addr: kafka.TCP("127.0.0.1:1"), BatchBytes: int64(messageSize(message))}
+	err := writer.WriteMessages(ctx, message)
+	assert.Error(t, err)
+	assert.False(t, errors.As(err, &kafka.MessageTooLargeError{}))
+
+	writer.BatchBytes--
+	assert.ErrorAs(t, writer.WriteMessages(ctx, message), &kafka.MessageTooLargeError{})
+}
+
+func TestBatch(t *testing.T) {
+	now := time.Date(2023, 3, 5, 4, 0, 0, 0, time.UTC)
+	message := kafka.Message{Key: []byte("2030-10"), Value: []byte(`{"Id":10}`)}
+
+	t.Run("count", func(t *testing.T) {
+		batch := Batch{policy: BatchPolicy{maxCount: 2}}
+		assert.Empty(t, batch.flushReason(now))
+
+		batch.add(message, now)
+		assert.Empty(t, batch.flushReason(now))
+		batch.add(message, now)
+		assert.Equal(t, FlushByCount, batch.flushReason(now))
+
+		assert.Len(t, batch.take(FlushByCount), 2)
+		assert.Equal(t, 0, batch.len())
+		assert.Equal(t, BatchStats{Batches: 1, Messages: 2, Bytes: 78, MaxBatchBytes: 78, ByCount: 1}, batch.stats)
+	})
+
+	t.Run("bytes", func(t *testing.T) {
+		batch := Batch{policy: BatchPolicy{maxCount: 10, maxBytes: 80}}
+		assert.True(t, batch.fits(kafka.Message{Value: make([]byte, 100)}), "empty batch fits any message")
+
+		batch.add(message, now)
+		assert.True(t, batch.fits(message))
+		batch.add(message, now)
+		assert.False(t, batch.fits(message))
+		assert.Empty(t, batch.flushReason(now))
+
+		batch.take(FlushByBytes)
+		batch.add(message, now)
+		batch.take(FlushByEnd)
+		assert.Equal(t, BatchStats{Batches: 2, Messages: 3, Bytes: 117, MaxBatchBytes: 78, ByBytes: 1, ByEnd: 1}, batch.stats)
+	})
+
+	t.Run("linger", func(t *testing.T) {
+		batch := Batch{policy: BatchPolicy{maxCount: 10, linger: time.Second}}
+
+		batch.add(message, now)
+		batch.add(message, now.Add(time.Millisecond*900))
+		assert.Empty(t, batch.flushReason(now.Add(time.Millisecond*999)))
+		assert.Equal(t, FlushByLinger, batch.flushReason(now.Add(time.Second)))
+
+		batch.take(FlushByLinger)
+		assert.Equal(t, 1, batch.stats.ByLinger)
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type Checkpoint struct {
+	LastId    uint
+	UpdatedAt time.Time
+}
+
+// CheckpointStore keeps id of the last written discipline of unfinished imports,
+// so redelivered meta event resumes the import instead of starting it over.
+type CheckpointStore struct {
+	filename    string
+	checkpoints map[string]Checkpoint
+}
+
+func NewCheckpointStore(filename string) (*CheckpointStore, error) {
+	store := &CheckpointStore{
+		filename:    filename,
+		checkpoints: map[string]Checkpoint{},
+	}
+
+	content, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if len(content) != 0 {
+		err = json.Unmarshal(content, &store.checkpoints)
+	}
+	if err != nil {
+		return nil, errors.New("Failed to parse checkpoints file " + filename + ": " + err.Error())
+	}
+
+	return store, nil
+}
+
+func (store *CheckpointStore) get(key string) (uint, bool) {
+	checkpoint, exists := store.checkpoints[key]
+	return checkpoint.LastId, exists
+}
+
+func (store *CheckpointStore) set(key string, lastId uint) error {
+	store.checkpoints[key] = Checkpoint{
+		LastId:    lastId,
+		UpdatedAt: time.Now(),
+	}
+
+	return store.save()
+}
+
+func (store *CheckpointStore) delete(key string) error {
+	if _, exists := store.checkpoints[key]; !exists {
+		return nil
+	}
+	delete(store.checkpoints, key)
+
+	return store.save()
+}
+
+func (store *CheckpointStore) save() error {
+	content, err := json.Marshal(store.checkpoints)
+	if err != nil {
+		return err
+	}
+
+	tmpFilename := filepath.Join(filepath.Dir(store.filename), "."+filepath.Base(store.filename)+".tmp")
+	if err = os.WriteFile(tmpFilename, content, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFilename, store.filename)
+}
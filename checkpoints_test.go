@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpointStore(t *testing.T) {
+	t.Run("set, load and delete", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "checkpoints.json")
+
+		store, err := NewCheckpointStore(filename)
+		assert.NoError(t, err)
+
+		_, exists := store.get("meta_events/0/10")
+		assert.False(t, exists)
+
+		assert.NoError(t, store.set("meta_events/0/10", 125))
+		assert.NoError(t, store.set("meta_events/0/11", 7))
+
+		store, err = NewCheckpointStore(filename)
+		assert.NoError(t, err)
+
+		lastId, exists := store.get("meta_events/0/10")
+		assert.True(t, exists)
+		assert.Equal(t, uint(125), lastId)
+
+		assert.NoError(t, store.delete("meta_events/0/10"))
+		assert.NoError(t, store.delete("not-exists"))
+
+		store, err = NewCheckpointStore(filename)
+		assert.NoError(t, err)
+
+		_, exists = store.get("meta_events/0/10")
+		assert.False(t, exists)
+		lastId, _ = store.get("meta_events/0/11")
+		assert.Equal(t, uint(7), lastId)
+	})
+
+	t.Run("broken file", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "checkpoints.json")
+		_ = os.WriteFile(filename, []byte("{broken"), 0644)
+
+		store, err := NewCheckpointStore(filename)
+		assert.ErrorContains(t, err, "Failed to parse checkpoints file")
+		assert.Nil(t, store)
+	})
+
+	t.Run("not writable", func(t *testing.T) {
+		store, err := NewCheckpointStore(filepath.Join(t.TempDir(), "not-exists", "checkpoints.json"))
+		assert.NoError(t, err)
+		assert.Error(t, store.set("key", 1))
+	})
+}
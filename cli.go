@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+const ExitCodeUsageError = 2
+
+const (
+	ServeCommand       = "serve"
+	ImportCommand      = "import"
+	ImportYearCommand  = "import-year"
+	ConfigCheckCommand = "config check"
+)
+
+const usage = `Usage:
+  secondary-db-disciplines-importer [serve]
+	import disciplines on meta events from Kafka (default)
+  secondary-db-disciplines-importer import --from DATETIME --to DATETIME --year YEAR
+	import disciplines registered in the window, DATETIME is "2006-01-02" or "2006-01-02 15:04:05"
+  secondary-db-disciplines-importer import-year YEAR
+	import all disciplines of the year, like on CurrentYearEvent
+  secondary-db-disciplines-importer config check
+	validate config and print effective settings with secrets redacted`
+
+var datetimeFlagFormats = []string{dateFormat, "2006-01-02", time.RFC3339}
+
+// UsageError is returned for wrong command line arguments.
+type UsageError struct {
+	message string
+}
+
+func (err UsageError) Error() string {
+	return err.message
+}
+
+type Command struct {
+	Name string
+	Task ImportTask
+}
+
+func parseCommand(args []string) (Command, error) {
+	if len(args) == 0 {
+		return Command{Name: ServeCommand}, nil
+	}
+
+	command := Command{Name: args[0]}
+	switch command.Name {
+	case ServeCommand:
+		if len(args) != 1 {
+			return Command{}, UsageError{"serve command has no arguments"}
+		}
+
+	case ImportCommand:
+		flags := flag.NewFlagSet(ImportCommand, flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		from := flags.String("from", "", "")
+		to := flags.String("to", "", "")
+		year := flags.Int("year", 0, "")
+
+		if err := flags.Parse(args[1:]); err != nil {
+			return Command{}, UsageError{"import: " + err.Error()}
+		}
+		if flags.NArg() != 0 {
+			return Command{}, UsageError{"import: unexpected arguments " + fmt.Sprint(flags.Args())}
+		}
+		if *year == 0 {
+			return Command{}, UsageError{"import: --year is required"}
+		}
+
+		var err error
+		command.Task.Year = *year
+		if command.Task.StartDatetime, err = parseDatetimeFlag(*from); err != nil {
+			return Command{}, UsageError{"import: wrong --from: " + err.Error()}
+		}
+		if command.Task.EndDatetime, err = parseDatetimeFlag(*to); err != nil {
+			return Command{}, UsageError{"import: wrong --to: " + err.Error()}
+		}
+		if !command.Task.StartDatetime.Before(command.Task.EndDatetime) {
+			return Command{}, UsageError{"import: --from should be before --to"}
+		}
+
+	case ImportYearCommand:
+		if len(args) != 2 {
+			return Command{}, UsageError{"import-year: expected one YEAR argument"}
+		}
+		year, err := strconv.Atoi(args[1])
+		if err != nil || year <= 0 {
+			return Command{}, UsageError{"import-year: wrong YEAR " + strconv.Quote(args[1])}
+		}
+		command.Task = yearImportTask(year, time.Now())
+
+	case "config":
+		if len(args) != 2 || args[1] != "check" {
+			return Command{}, UsageError{"config: expected check subcommand"}
+		}
+		command.Name = ConfigCheckCommand
+
+	default:
+		return Command{}, UsageError{"unknown command " + strconv.Quote(command.Name)}
+	}
+
+	return command, nil
+}
+
+func parseDatetimeFlag(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, errors.New("value is required")
+	}
+
+	for _, format := range datetimeFlagFormats {
+		if datetime, err := time.ParseInLocation(format, value, time.Local); err == nil {
+			return datetime, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unknown datetime format %q", value)
+}
+
+// yearImportTask covers all disciplines of the year: since August of previous academic year up to the current hour.
+func yearImportTask(year int, now time.Time) ImportTask {
+	return ImportTask{
+		StartDatetime: time.Date(year-2, 8, 1, 0, 0, 0, 0, time.Local),
+		EndDatetime:   time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, now.Location()),
+		Year:          year,
+		FullImport:    true,
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseCommand(t *testing.T) {
+	t.Run("serve by default", func(t *testing.T) {
+		command, err := parseCommand(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, Command{Name: ServeCommand}, command)
+
+		command, err = parseCommand([]string{"serve"})
+		assert.NoError(t, err)
+		assert.Equal(t, Command{Name: ServeCommand}, command)
+	})
+
+	t.Run("import", func(t *testing.T) {
+		command, err := parseCommand([]string{"import", "--from", "2023-03-05", "--to=2023-03-06 04:30:00", "--year", "2022"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, Command{
+			Name: ImportCommand,
+			Task: ImportTask{
+				StartDatetime: time.Date(2023, 3, 5, 0, 0, 0, 0, time.Local),
+				EndDatetime:   time.Date(2023, 3, 6, 4, 30, 0, 0, time.Local),
+				Year:          2022,
+			},
+		}, command)
+	})
+
+	t.Run("import year", func(t *testing.T) {
+		command, err := parseCommand([]string{"import-year", "2024"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, ImportYearCommand, command.Name)
+		assert.Equal(t, 2024, command.Task.Year)
+		assert.True(t, command.Task.FullImport)
+		assert.Equal(t, time.Date(2022, 8, 1, 0, 0, 0, 0, time.Local), command.Task.StartDatetime)
+	})
+
+	t.Run("config check", func(t *testing.T) {
+		command, err := parseCommand([]string{"config", "check"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, Command{Name: ConfigCheckCommand}, command)
+	})
+
+	t.Run("wrong arguments", func(t *testing.T) {
+		testCases := map[string][]string{
+			`unknown command "export"`:                {"export"},
+			"serve command has no arguments":          {"serve", "now"},
+			"import: --year is required":              {"import", "--from", "2023-03-05", "--to", "2023-03-06"},
+			"import: wrong --from: value is required": {"import", "--to", "2023-03-06", "--year", "2022"},
+			`import: wrong --to: unknown datetime format "06.03.2023"`: {
+				"import", "--from", "2023-03-05", "--to", "06.03.2023", "--year", "2022",
+			},
+			"import: --from should be before --to": {
+				"import", "--from", "2023-03-06", "--to", "2023-03-05", "--year", "2022",
+			},
+			"import: unexpected arguments [extra]": {
+				"import", "--from", "2023-03-05", "--to", "2023-03-06", "--year", "2022", "extra",
+			},
+			"import: flag provided but not defined: -until": {"import", "--until", "2023-03-06"},
+			"import-year: expected one YEAR argument":       {"import-year"},
+			`import-year: wrong YEAR "last"`:                {"import-year", "last"},
+			"config: expected check subcommand":             {"config", "print"},
+		}
+
+		for expectedError, args := range testCases {
+			_, err := parseCommand(args)
+			assert.Equal(t, UsageError{expectedError}, err, args)
+		}
+	})
+}
+
+func TestYearImportTask(t *testing.T) {
+	now := time.Date(2024, 3, 5, 14, 35, 10, 0, time.Local)
+
+	assert.Equal(t, ImportTask{
+		StartDatetime: time.Date(2022, 8, 1, 0, 0, 0, 0, time.Local),
+		EndDatetime:   time.Date(2024, 3, 5, 14, 0, 0, 0, time.Local),
+		Year:          2024,
+		FullImport:    true,
+	}, yearImportTask(2024, now))
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// settings describes effective config by setting names in the order of .env.example, secrets are redacted.
+func (config Config) settings() [][2]string {
+	settings := [][2]string{
+		{"KAFKA_HOST", strings.Join(config.kafkaBrokers, ",")},
+		{"SECONDARY_DEKANAT_DB_DSN", redactDsn(config.secondaryDekanatDbDSN)},
+		{"SECONDARY_DEKANAT_DB_HOST", config.dbConnection.host},
+		{"SECONDARY_DEKANAT_DB_PORT", config.dbConnection.port},
+		{"SECONDARY_DEKANAT_DB_DATABASE", config.dbConnection.database},
+		{"SECONDARY_DEKANAT_DB_USER", config.dbConnection.user},
+		{"SECONDARY_DEKANAT_DB_PASSWORD", redactSecret(config.dbConnection.password)},
+		{"SECONDARY_DEKANAT_DB_CHARSET", config.dbConnection.charset},
+		{"SECONDARY_DEKANAT_DB_ROLE", config.dbConnection.role},
+		{"DEKANAT_DB_DRIVER_NAME", config.dekanatDbDriverName},
+		{"DEKANAT_DB_DIALECT", config.dialect.Name},
+		{"DEKANAT_DB_QUOTE_IDENTIFIERS", strconv.FormatBool(config.quoteIdentifiers)},
+		{"KAFKA_TIMEOUT", config.kafkaTimeout.String()},
+		{"KAFKA_ATTEMPTS", strconv.Itoa(config.kafkaAttempts)},
+		{"DISCIPLINES_KEY_MODE", string(config.keyMode)},
+		{"DISCIPLINES_PAYLOAD_VERSION", strconv.Itoa(config.payloadVersion)},
+		{"DISCIPLINES_ENRICHMENT_JOINS", config.enrichment.Joins},
+		{"DISCIPLINES_ENRICHMENT_LECTURER", config.enrichment.Lecturer},
+		{"DISCIPLINES_ENRICHMENT_DEPARTMENT", config.enrichment.Department},
+		{"DISCIPLINES_ENRICHMENT_SEMESTER", config.enrichment.Semester},
+		{"DISCIPLINES_ENRICHMENT_STUDY_FORM", config.enrichment.StudyForm},
+		{"DISCIPLINES_QUERY_FILE", config.queryFile},
+		{"DISCIPLINES_NAME_NORMALIZERS", formatNameNormalizer(config.nameNormalizer)},
+		{"DISCIPLINES_KEEP_RAW_NAME", strconv.FormatBool(config.keepRawName)},
+		{"FINGERPRINTS_FILE", config.fingerprintsFile},
+		{"FORCE_IMPORT", strconv.FormatBool(config.forceImport)},
+		{"CHECKPOINTS_FILE", config.checkpointsFile},
+		{"DEAD_LETTER_TOPIC", config.deadLetterTopic},
+		{"DEAD_LETTER_FILE", config.deadLetterFile},
+		{"DEAD_LETTER_MAX_ROWS", strconv.Itoa(config.maxInvalidRows)},
+		{"DRY_RUN", strconv.FormatBool(config.dryRun)},
+		{"DRY_RUN_OUTPUT", config.dryRunOutput},
+	}
+
+	kinds := make([]string, len(config.sinks))
+	for i, sink := range config.sinks {
+		kinds[i] = sink.kind
+	}
+	settings = append(settings, [2]string{"OUTPUT_SINKS", strings.Join(kinds, ",")})
+
+	for _, sink := range config.sinks {
+		settings = append(settings, [2]string{sinkPolicyEnv(sink.kind), sink.policy})
+		switch sink.kind {
+		case FileSink:
+			settings = append(
+				settings,
+				[2]string{"OUTPUT_FILE", sink.file},
+				[2]string{"OUTPUT_FILE_FORMAT", sink.fileFormat},
+				[2]string{"OUTPUT_FILE_MAX_BYTES", strconv.FormatInt(sink.fileMaxBytes, 10)},
+			)
+		case WebhookSink:
+			settings = append(
+				settings,
+				[2]string{"OUTPUT_WEBHOOK_URL", redactUrl(sink.webhookUrl)},
+				[2]string{"OUTPUT_WEBHOOK_AUTHORIZATION", redactSecret(sink.webhookAuthorization)},
+				[2]string{"OUTPUT_WEBHOOK_BATCH_SIZE", strconv.Itoa(sink.webhookBatchSize)},
+				[2]string{"OUTPUT_WEBHOOK_ATTEMPTS", strconv.Itoa(sink.webhookAttempts)},
+				[2]string{"OUTPUT_WEBHOOK_TIMEOUT", sink.webhookTimeout.String()},
+			)
+		}
+	}
+
+	return append(
+		settings,
+		[2]string{"LIFECYCLE_EVENTS", strconv.FormatBool(config.lifecycleEvents)},
+		[2]string{"LIFECYCLE_EVENTS_TOPIC", config.lifecycleTopic},
+		[2]string{"SOURCE_DB_IDENTITY", config.sourceDbIdentity},
+		[2]string{"TRACING_ENABLED", strconv.FormatBool(config.tracing)},
+		[2]string{"WRITE_RETRY_INITIAL_DELAY", config.writeRetry.initialDelay.String()},
+		[2]string{"WRITE_RETRY_MAX_DELAY", config.writeRetry.maxDelay.String()},
+		[2]string{"WRITE_RETRY_MAX_DURATION", config.writeRetry.maxDuration.String()},
+		[2]string{"OUTBOX_DIR", config.outboxDir},
+		[2]string{"OUTBOX_FLUSH_INTERVAL", config.outboxFlushInterval.String()},
+		[2]string{"BATCH_MAX_MESSAGES", strconv.Itoa(config.batch.maxCount)},
+		[2]string{"BATCH_MAX_BYTES", strconv.Itoa(config.batch.maxBytes)},
+		[2]string{"BATCH_LINGER", config.batch.linger.String()},
+		[2]string{"KAFKA_PRODUCER_COMPRESSION", formatCompression(config.producer.compression)},
+		[2]string{"KAFKA_PRODUCER_ACKS", config.producer.requiredAcks.String()},
+		[2]string{"KAFKA_PRODUCER_ASYNC", strconv.FormatBool(config.producer.async)},
+		[2]string{"KAFKA_PRODUCER_WRITE_TIMEOUT", config.producer.writeTimeout.String()},
+		[2]string{"KAFKA_PRODUCER_BATCH_TIMEOUT", config.producer.batchTimeout.String()},
+		[2]string{"KAFKA_PRODUCER_BALANCER", config.producer.balancer},
+		[2]string{"KAFKA_TLS_ENABLED", strconv.FormatBool(config.kafkaSecurity.tlsEnabled)},
+		[2]string{"KAFKA_TLS_CA_FILE", config.kafkaSecurity.tlsCaFile},
+		[2]string{"KAFKA_TLS_CERT_FILE", config.kafkaSecurity.tlsCertFile},
+		[2]string{"KAFKA_TLS_KEY_FILE", config.kafkaSecurity.tlsKeyFile},
+		[2]string{"KAFKA_TLS_SERVER_NAME", config.kafkaSecurity.tlsServerName},
+		[2]string{"KAFKA_SASL_MECHANISM", config.kafkaSecurity.saslMechanism},
+		[2]string{"KAFKA_SASL_USERNAME", config.kafkaSecurity.saslUsername},
+		[2]string{"KAFKA_SASL_PASSWORD", redactSecret(config.kafkaSecurity.saslPassword)},
+		[2]string{"DISCIPLINES_TOPIC", config.disciplinesTopic},
+		[2]string{"META_EVENTS_TOPIC", config.metaEventsTopic},
+		[2]string{"KAFKA_CONSUMER_GROUP_ID", config.consumerGroupId},
+	)
+}
+
+// print writes effective config in .env format, so it can be compared with deployment settings.
+func (config Config) print(out io.Writer) {
+	for _, setting := range config.settings() {
+		fmt.Fprintf(out, "%s=%s\n", setting[0], setting[1])
+	}
+	for _, warning := range config.warnings() {
+		fmt.Fprintf(out, "# warning: %s\n", warning)
+	}
+}
+
+func formatNameNormalizer(normalizer NameNormalizer) string {
+	if len(normalizer) == 0 {
+		return "none"
+	}
+
+	return strings.Join(normalizer, ",")
+}
+
+func formatCompression(compression kafka.Compression) string {
+	if compression == 0 {
+		return "none"
+	}
+
+	return compression.String()
+}
@@ -3,18 +3,58 @@ package main
 import (
 	"errors"
 	"fmt"
+	"github.com/go-sql-driver/mysql"
 	"github.com/joho/godotenv"
+	"github.com/kneu-messenger-pigeon/events"
 	"os"
-	"strconv"
+	"slices"
+	"strings"
 	"time"
 )
 
+const DefaultConsumerGroupId = "secondary-db-disciplines-importer"
+
+// DryRunConsumerGroupSuffix keeps dry run out of consumer group of real importer, so it does not take its partitions.
+const DryRunConsumerGroupSuffix = "-dry-run"
+
 type Config struct {
 	dekanatDbDriverName   string
-	kafkaHost             string
+	kafkaBrokers          []string
 	secondaryDekanatDbDSN string
+	dbConnection          DbConnection
 	kafkaTimeout          time.Duration
 	kafkaAttempts         int
+	keyMode               KeyMode
+	fingerprintsFile      string
+	forceImport           bool
+	payloadVersion        int
+	queryFile             string
+	enrichment            DisciplineEnrichment
+	query                 DisciplinesQuery
+	dialect               SqlDialect
+	quoteIdentifiers      bool
+	nameNormalizer        NameNormalizer
+	keepRawName           bool
+	deadLetterTopic       string
+	deadLetterFile        string
+	maxInvalidRows        int
+	checkpointsFile       string
+	dryRun                bool
+	dryRunOutput          string
+	sinks                 []SinkConfig
+	lifecycleEvents       bool
+	lifecycleTopic        string
+	sourceDbIdentity      string
+	tracing               bool
+	writeRetry            RetryPolicy
+	outboxDir             string
+	outboxFlushInterval   time.Duration
+	batch                 BatchPolicy
+	producer              ProducerConfig
+	kafkaSecurity         KafkaSecurityConfig
+	disciplinesTopic      string
+	metaEventsTopic       string
+	consumerGroupId       string
 }
 
 func loadConfig(envFilename string) (Config, error) {
@@ -25,35 +65,262 @@ func loadConfig(envFilename string) (Config, error) {
 		}
 	}
 
-	kafkaTimeout, err := strconv.Atoi(os.Getenv("KAFKA_TIMEOUT"))
-	if kafkaTimeout == 0 || err != nil {
-		kafkaTimeout = 10
+	source, err := NewConfigSource(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		return Config{}, errors.New("wrong CONFIG_FILE: " + err.Error())
 	}
 
-	kafkaAttempts, err := strconv.Atoi(os.Getenv("KAFKA_ATTEMPTS"))
-	if kafkaAttempts == 0 || err != nil {
-		kafkaAttempts = 0
-	}
+	return loadConfigFromSource(source)
+}
+
+// loadConfigFromSource reads and validates all settings, every found problem is reported in ConfigError.
+func loadConfigFromSource(source *ConfigSource) (Config, error) {
+	var problems ConfigProblems
+	var err error
+
+	// prefix isolates environments sharing one cluster, explicitly set names are used as is
+	topicPrefix := source.get("KAFKA_TOPIC_PREFIX")
 
 	config := Config{
-		dekanatDbDriverName:   os.Getenv("DEKANAT_DB_DRIVER_NAME"),
-		secondaryDekanatDbDSN: os.Getenv("SECONDARY_DEKANAT_DB_DSN"),
-		kafkaHost:             os.Getenv("KAFKA_HOST"),
-		kafkaTimeout:          time.Second * time.Duration(kafkaTimeout),
-		kafkaAttempts:         kafkaAttempts,
+		dekanatDbDriverName: source.getOrDefault("DEKANAT_DB_DRIVER_NAME", "firebirdsql"),
+		fingerprintsFile:    source.get("FINGERPRINTS_FILE"),
+		queryFile:           source.get("DISCIPLINES_QUERY_FILE"),
+		deadLetterTopic:     source.get("DEAD_LETTER_TOPIC"),
+		deadLetterFile:      source.get("DEAD_LETTER_FILE"),
+		checkpointsFile:     source.get("CHECKPOINTS_FILE"),
+		dryRunOutput:        source.get("DRY_RUN_OUTPUT"),
+		sourceDbIdentity:    source.get("SOURCE_DB_IDENTITY"),
+		outboxDir:           source.get("OUTBOX_DIR"),
+		disciplinesTopic:    source.getOrDefault("DISCIPLINES_TOPIC", topicPrefix+events.DisciplinesTopic),
+		metaEventsTopic:     source.getOrDefault("META_EVENTS_TOPIC", topicPrefix+events.MetaEventsTopic),
+		consumerGroupId:     source.getOrDefault("KAFKA_CONSUMER_GROUP_ID", topicPrefix+DefaultConsumerGroupId),
+	}
+	config.lifecycleTopic = source.getOrDefault("LIFECYCLE_EVENTS_TOPIC", config.metaEventsTopic)
+
+	config.secondaryDekanatDbDSN, err = source.secret("SECONDARY_DEKANAT_DB_DSN")
+	problems.add(err)
+	dsnIsLoaded := err == nil
+
+	config.dbConnection, err = loadDbConnection(source)
+	problems.add(err)
+
+	config.kafkaBrokers, err = parseBrokers(source.get("KAFKA_HOST"))
+	problems.add(prefixError("wrong KAFKA_HOST: ", err))
+	if err == nil && len(config.kafkaBrokers) == 0 {
+		problems.add(errors.New("empty KAFKA_HOST: set comma separated list of brokers, e.g. kafka:9092"))
+	}
+
+	config.kafkaTimeout, err = source.timeout("KAFKA_TIMEOUT", time.Second*10)
+	problems.add(err)
+
+	config.kafkaAttempts, err = source.int("KAFKA_ATTEMPTS", 0, 0)
+	problems.add(err)
+
+	config.forceImport, err = source.bool("FORCE_IMPORT", false)
+	problems.add(err)
+
+	config.payloadVersion, err = source.int("DISCIPLINES_PAYLOAD_VERSION", DisciplinePayloadVersion1, 0)
+	problems.add(err)
+	payloadVersionIsValid := config.payloadVersion == DisciplinePayloadVersion1 || config.payloadVersion == DisciplinePayloadVersion2
+	if err == nil && !payloadVersionIsValid {
+		problems.add(fmt.Errorf(
+			"wrong DISCIPLINES_PAYLOAD_VERSION: unsupported payload version %d, expected 1 or 2", config.payloadVersion,
+		))
+	}
+
+	config.maxInvalidRows, err = source.int("DEAD_LETTER_MAX_ROWS", 100, 0)
+	problems.add(err)
+
+	config.dryRun, err = source.bool("DRY_RUN", false)
+	problems.add(err)
+	if config.dryRun {
+		config.consumerGroupId += DryRunConsumerGroupSuffix
+	}
+
+	config.lifecycleEvents, err = source.bool("LIFECYCLE_EVENTS", false)
+	problems.add(err)
+
+	config.tracing, err = source.bool("TRACING_ENABLED", false)
+	problems.add(err)
+
+	config.keepRawName, err = source.bool("DISCIPLINES_KEEP_RAW_NAME", false)
+	problems.add(err)
+
+	config.writeRetry.initialDelay, err = source.duration("WRITE_RETRY_INITIAL_DELAY", time.Millisecond*100)
+	problems.add(err)
+	config.writeRetry.maxDelay, err = source.duration("WRITE_RETRY_MAX_DELAY", time.Second*5)
+	problems.add(err)
+	config.writeRetry.maxDuration, err = source.duration("WRITE_RETRY_MAX_DURATION", time.Minute)
+	problems.add(err)
+
+	config.outboxFlushInterval, err = source.duration("OUTBOX_FLUSH_INTERVAL", time.Second*5)
+	problems.add(err)
+
+	config.batch.maxCount, err = source.int("BATCH_MAX_MESSAGES", 100, 1)
+	problems.add(err)
+	config.batch.maxBytes, err = source.int("BATCH_MAX_BYTES", 1000000, 0)
+	problems.add(err)
+	config.batch.linger, err = source.duration("BATCH_LINGER", 0)
+	problems.add(err)
+
+	config.nameNormalizer, err = parseNameNormalizer(source.get("DISCIPLINES_NAME_NORMALIZERS"))
+	problems.add(prefixError("wrong DISCIPLINES_NAME_NORMALIZERS: ", err))
+
+	config.keyMode, err = parseKeyMode(source.get("DISCIPLINES_KEY_MODE"))
+	problems.add(prefixError("wrong DISCIPLINES_KEY_MODE: ", err))
+
+	config.sinks, err = loadSinkConfigs(source, config.disciplinesTopic)
+	problems.add(err)
+
+	config.producer, err = loadProducerConfig(source, config.keyMode)
+	problems.add(err)
+
+	config.kafkaSecurity, err = loadKafkaSecurityConfig(source)
+	problems.add(err)
+
+	config.enrichment = DisciplineEnrichment{
+		Joins:      source.get("DISCIPLINES_ENRICHMENT_JOINS"),
+		Lecturer:   source.get("DISCIPLINES_ENRICHMENT_LECTURER"),
+		Department: source.get("DISCIPLINES_ENRICHMENT_DEPARTMENT"),
+		Semester:   source.get("DISCIPLINES_ENRICHMENT_SEMESTER"),
+		StudyForm:  source.get("DISCIPLINES_ENRICHMENT_STUDY_FORM"),
+	}
+
+	if config.keepRawName && payloadVersionIsValid && config.payloadVersion != DisciplinePayloadVersion2 {
+		problems.add(errors.New("DISCIPLINES_KEEP_RAW_NAME requires DISCIPLINES_PAYLOAD_VERSION=2"))
+	}
+
+	if config.deadLetterTopic != "" && config.deadLetterFile != "" {
+		problems.add(errors.New("only one of DEAD_LETTER_TOPIC and DEAD_LETTER_FILE can be set"))
+	}
+
+	if config.writeRetry.initialDelay <= 0 || config.writeRetry.initialDelay > config.writeRetry.maxDelay {
+		problems.add(errors.New("WRITE_RETRY_INITIAL_DELAY should be positive and not greater than WRITE_RETRY_MAX_DELAY"))
+	}
+
+	if config.outboxFlushInterval == 0 {
+		problems.add(errors.New("wrong OUTBOX_FLUSH_INTERVAL: should be positive"))
+	}
+
+	// outbox spills batches of Kafka sink only, other sinks are written directly
+	toKafka := slices.ContainsFunc(config.sinks, func(sink SinkConfig) bool { return sink.kind == KafkaSink })
+	if config.outboxDir != "" && config.sinks != nil && !toKafka {
+		problems.add(errors.New("OUTBOX_DIR requires kafka sink in OUTPUT_SINKS"))
+	}
+
+	// async producer does not report failed writes, so they can not be spilled into outbox; fingerprints and
+	// checkpoints would be stored for messages, which were only queued and may be lost
+	if config.producer.async && config.outboxDir != "" {
+		problems.add(errors.New("KAFKA_PRODUCER_ASYNC can not be used with OUTBOX_DIR"))
+	}
+	if config.producer.async && config.fingerprintsFile != "" {
+		problems.add(errors.New("KAFKA_PRODUCER_ASYNC can not be used with FINGERPRINTS_FILE"))
+	}
+	if config.producer.async && config.checkpointsFile != "" {
+		problems.add(errors.New("KAFKA_PRODUCER_ASYNC can not be used with CHECKPOINTS_FILE"))
+	}
+
+	config.dialect, err = resolveSqlDialect(source.get("DEKANAT_DB_DIALECT"), config.dekanatDbDriverName)
+	problems.add(prefixError("wrong DEKANAT_DB_DIALECT: ", err))
+	// enrichment query is built for dialect, so it is checked only with valid dialect
+	dialectIsValid := err == nil
+
+	// quoted identifiers are case-sensitive, so mirror with lower-case names needs them unquoted
+	config.quoteIdentifiers, err = source.bool("DEKANAT_DB_QUOTE_IDENTIFIERS", true)
+	problems.add(err)
+	if !config.quoteIdentifiers {
+		config.dialect = config.dialect.withoutQuotes()
+	}
+
+	queryIsLoaded := false
+	if config.queryFile != "" && !config.enrichment.isEmpty() {
+		problems.add(errors.New("DISCIPLINES_ENRICHMENT_* settings can not be used with DISCIPLINES_QUERY_FILE"))
+	} else if config.queryFile != "" {
+		config.query, err = loadDisciplinesQuery(config.queryFile)
+		problems.add(prefixError("wrong DISCIPLINES_QUERY_FILE: ", err))
+		queryIsLoaded = err == nil
+	} else if dialectIsValid {
+		config.query, queryIsLoaded = config.enrichment.buildQuery(config.dialect), true
+	}
+
+	if queryIsLoaded && payloadVersionIsValid {
+		problems.add(prefixError("wrong disciplines query: ", config.query.validate(config.payloadVersion)))
+	}
+
+	if config.secondaryDekanatDbDSN != "" && !config.dbConnection.isEmpty() {
+		problems.add(errors.New(
+			"SECONDARY_DEKANAT_DB_DSN can not be used with SECONDARY_DEKANAT_DB_HOST, _DATABASE and other connection settings",
+		))
+	} else if !config.dbConnection.isEmpty() {
+		config.secondaryDekanatDbDSN, err = config.dbConnection.dsn(config.dekanatDbDriverName)
+		problems.add(err)
+	} else if config.secondaryDekanatDbDSN == "" && dsnIsLoaded {
+		problems.add(errors.New("empty SECONDARY_DEKANAT_DB_DSN: set connection string of secondary Dekanat DB " +
+			"or SECONDARY_DEKANAT_DB_HOST and SECONDARY_DEKANAT_DB_DATABASE"))
 	}
 
-	if config.dekanatDbDriverName == "" {
-		config.dekanatDbDriverName = "firebirdsql"
+	// mysql driver converts bound datetime into loc of DSN, which is UTC by default and would shift the import window;
+	// assembled DSN has loc=Local
+	if config.dekanatDbDriverName == "mysql" && config.dialect.nativeDatetime && config.dbConnection.isEmpty() &&
+		config.secondaryDekanatDbDSN != "" {
+		if parsed, err := mysql.ParseDSN(config.secondaryDekanatDbDSN); err == nil && parsed.Loc != time.Local {
+			problems.add(errors.New("SECONDARY_DEKANAT_DB_DSN of mysql driver requires loc=Local: datetime is bound as local time"))
+		}
 	}
 
-	if config.secondaryDekanatDbDSN == "" {
-		return Config{}, errors.New("empty SECONDARY_DEKANAT_DB_DSN")
+	if config.sourceDbIdentity == "" {
+		config.sourceDbIdentity = sourceDbIdentity(config.dekanatDbDriverName, config.secondaryDekanatDbDSN)
 	}
 
-	if config.kafkaHost == "" {
-		return Config{}, errors.New("empty KAFKA_HOST")
+	problems.add(source.unknownSettings())
+
+	if err = problems.err(); err != nil {
+		return Config{}, err
 	}
 
 	return config, nil
 }
+
+// warnings reports valid, but risky combinations of settings.
+func (config Config) warnings() []string {
+	var warnings []string
+
+	// retried and spilled writes may duplicate messages, which consumers can drop only by discipline key
+	// of the same partition
+	duplicatesPossible := config.writeRetry.maxDuration != 0 || config.outboxDir != ""
+	toKafka := slices.ContainsFunc(config.sinks, func(sink SinkConfig) bool { return sink.kind == KafkaSink })
+	if duplicatesPossible && toKafka && !config.dryRun &&
+		(config.keyMode != DisciplineKeyMode || !config.producer.keepsKeyPartition()) {
+		warnings = append(warnings, "retried writes may publish duplicates, consumers can drop them only with "+
+			"DISCIPLINES_KEY_MODE=discipline and KAFKA_PRODUCER_BALANCER=hash, crc32 or murmur2")
+	}
+
+	return warnings
+}
+
+// prefixError adds setting name to parse error, nil stays nil.
+func prefixError(prefix string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return errors.New(prefix + err.Error())
+}
+
+// parseBrokers splits comma separated list of broker addresses; empty value gives empty list.
+func parseBrokers(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var brokers []string
+	for _, broker := range strings.Split(value, ",") {
+		broker = strings.TrimSpace(broker)
+		if broker == "" {
+			return nil, fmt.Errorf("empty broker address in %q", value)
+		}
+		brokers = append(brokers, broker)
+	}
+
+	return brokers, nil
+}
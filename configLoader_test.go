@@ -2,24 +2,65 @@ package main
 
 import (
 	"fmt"
+	"github.com/kneu-messenger-pigeon/events"
+	"github.com/segmentio/kafka-go"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
 
 var expectedConfig = Config{
-	kafkaHost:             "KAFKA:9999",
+	kafkaBrokers:          []string{"KAFKA:9999"},
 	dekanatDbDriverName:   "firebird-test",
 	secondaryDekanatDbDSN: "USER:PASSOWORD@HOST/DATABASE",
 	kafkaTimeout:          time.Second * 10,
 	kafkaAttempts:         0,
+	keyMode:               LegacyKeyMode,
+	payloadVersion:        DisciplinePayloadVersion1,
+	query:                 DisciplineEnrichment{}.buildQuery(FirebirdDialect),
+	dialect:               FirebirdDialect,
+	quoteIdentifiers:      true,
+	nameNormalizer:        NameNormalizer{"nfc", "whitespace", "apostrophe", "homoglyph"},
+	maxInvalidRows:        100,
+	sinks: []SinkConfig{{
+		kind:             KafkaSink,
+		policy:           RequiredSinkPolicy,
+		kafkaTopic:       events.DisciplinesTopic,
+		fileFormat:       JsonlFileFormat,
+		webhookBatchSize: 100,
+		webhookAttempts:  3,
+		webhookTimeout:   time.Second * 10,
+	}},
+	lifecycleEvents:  false,
+	lifecycleTopic:   events.MetaEventsTopic,
+	disciplinesTopic: events.DisciplinesTopic,
+	metaEventsTopic:  events.MetaEventsTopic,
+	consumerGroupId:  "secondary-db-disciplines-importer",
+	// credentials are not published in headers
+	sourceDbIdentity: "firebird-test:HOST/DATABASE",
+	writeRetry: RetryPolicy{
+		initialDelay: time.Millisecond * 100,
+		maxDelay:     time.Second * 5,
+		maxDuration:  time.Minute,
+	},
+	outboxFlushInterval: time.Second * 5,
+	batch:               BatchPolicy{maxCount: 100, maxBytes: 1000000},
+	producer: ProducerConfig{
+		compression:  kafka.Zstd,
+		requiredAcks: kafka.RequireAll,
+		writeTimeout: time.Second * 10,
+		batchTimeout: time.Second,
+		balancer:     LeastBytesBalancer,
+	},
 }
 
 func TestLoadConfigFromEnvVars(t *testing.T) {
 	t.Run("FromEnvVars", func(t *testing.T) {
-		_ = os.Setenv("KAFKA_HOST", expectedConfig.kafkaHost)
+		_ = os.Setenv("KAFKA_HOST", strings.Join(expectedConfig.kafkaBrokers, ","))
 		_ = os.Setenv("DEKANAT_DB_DRIVER_NAME", expectedConfig.dekanatDbDriverName)
 		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", expectedConfig.secondaryDekanatDbDSN)
 		_ = os.Setenv("KAFKA_TIMEOUT", strconv.Itoa(int(expectedConfig.kafkaTimeout.Seconds())))
@@ -35,7 +76,7 @@ func TestLoadConfigFromEnvVars(t *testing.T) {
 	t.Run("FromFile", func(t *testing.T) {
 		var envFileContent string
 
-		envFileContent += fmt.Sprintf("KAFKA_HOST=%s\n", expectedConfig.kafkaHost)
+		envFileContent += fmt.Sprintf("KAFKA_HOST=%s\n", strings.Join(expectedConfig.kafkaBrokers, ","))
 		envFileContent += fmt.Sprintf("SECONDARY_DEKANAT_DB_DSN=%s\n", expectedConfig.secondaryDekanatDbDSN)
 
 		testEnvFilename := "TestLoadConfigFromFile.env"
@@ -66,7 +107,7 @@ func TestLoadConfigFromEnvVars(t *testing.T) {
 			"Expected for empty config.secondaryDekanatDbDSN, actual %s", config.secondaryDekanatDbDSN,
 		)
 		assert.Emptyf(
-			t, config.kafkaHost,
+			t, config.kafkaBrokers,
 			"Expected for empty config.secondaryDekanatDbDSN, actual %s", config.secondaryDekanatDbDSN,
 		)
 
@@ -75,15 +116,92 @@ func TestLoadConfigFromEnvVars(t *testing.T) {
 
 		assert.Error(t, err, "loadConfig() should exit with error, actual error is nil")
 		assert.Equalf(
-			t, "empty KAFKA_HOST", err.Error(),
+			t, "empty KAFKA_HOST: set comma separated list of brokers, e.g. kafka:9092", err.Error(),
 			"Expected for error with empty SECONDARY_DEKANAT_DB_DSN, actual: %s", err.Error(),
 		)
 		assert.Emptyf(
-			t, config.kafkaHost,
+			t, config.kafkaBrokers,
 			"Expected for empty config.secondaryDekanatDbDSN, actual %s", config.secondaryDekanatDbDSN,
 		)
 	})
 
+	t.Run("ConfigFile", func(t *testing.T) {
+		configFile := filepath.Join(t.TempDir(), "config.yaml")
+		_ = os.WriteFile(configFile, []byte(`
+kafka:
+  host: [kafka-1:9092, kafka-2:9092]
+  timeout: 30s
+secondary_dekanat_db_dsn: USER:PASSWORD@HOST/DATABASE
+batch:
+  max_messages: 500
+  linger: 2s
+`), 0600)
+
+		_ = os.Setenv("CONFIG_FILE", configFile)
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "")
+		_ = os.Setenv("KAFKA_HOST", "")
+		_ = os.Setenv("BATCH_MAX_MESSAGES", "50")
+		defer os.Unsetenv("CONFIG_FILE")
+		defer os.Unsetenv("BATCH_MAX_MESSAGES")
+
+		config, err := loadConfig("")
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"kafka-1:9092", "kafka-2:9092"}, config.kafkaBrokers)
+		assert.Equal(t, time.Second*30, config.kafkaTimeout)
+		assert.Equal(t, "USER:PASSWORD@HOST/DATABASE", config.secondaryDekanatDbDSN)
+		assert.Equal(t, BatchPolicy{maxCount: 50, maxBytes: 1000000, linger: time.Second * 2}, config.batch)
+
+		_ = os.WriteFile(configFile, []byte("kafka: {host: kafka:9092, timout: 30s}\nsecondary_dekanat_db_dsn: dummy\n"), 0600)
+		_, err = loadConfig("")
+		assert.EqualError(t, err, "unknown setting KAFKA_TIMOUT in "+configFile+", check spelling of its key")
+
+		_ = os.Setenv("CONFIG_FILE", configFile+".ini")
+		_, err = loadConfig("")
+		assert.EqualError(t, err, "wrong CONFIG_FILE: unknown format of "+configFile+".ini, expected .yaml, .yml or .toml file")
+	})
+
+	t.Run("ExampleConfigFile", func(t *testing.T) {
+		_ = os.Setenv("CONFIG_FILE", "config.example.yaml")
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "")
+		_ = os.Setenv("KAFKA_HOST", "")
+		defer os.Unsetenv("CONFIG_FILE")
+
+		config, err := loadConfig("")
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"kafka-1:9092", "kafka-2:9092"}, config.kafkaBrokers)
+		assert.Equal(t, "staging.secondary-db-disciplines-importer", config.consumerGroupId)
+		assert.Equal(t, DisciplineKeyMode, config.keyMode)
+		assert.Equal(t, HashBalancer, config.producer.balancer)
+		assert.Equal(t, "USER@HOST/DATABASE?charset=WIN1251", config.secondaryDekanatDbDSN)
+	})
+
+	t.Run("AllProblemsConfig", func(t *testing.T) {
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "")
+		_ = os.Setenv("KAFKA_HOST", "")
+		_ = os.Setenv("KAFKA_TIMEOUT", "abc")
+		_ = os.Setenv("DRY_RUN", "yes")
+		_ = os.Setenv("DEAD_LETTER_MAX_ROWS", "-5")
+		_ = os.Setenv("OUTPUT_SINKS", "kafka,ftp")
+		defer os.Unsetenv("KAFKA_TIMEOUT")
+		defer os.Unsetenv("DRY_RUN")
+		defer os.Unsetenv("DEAD_LETTER_MAX_ROWS")
+		defer os.Unsetenv("OUTPUT_SINKS")
+
+		_, err := loadConfig("")
+
+		assert.EqualError(t, err, "6 problems:"+
+			"\n  - empty KAFKA_HOST: set comma separated list of brokers, e.g. kafka:9092"+
+			"\n  - wrong KAFKA_TIMEOUT: time: invalid duration \"abc\", expected duration like \"10s\" or number of seconds"+
+			"\n  - wrong DEAD_LETTER_MAX_ROWS: expected not negative number, got \"-5\""+
+			"\n  - wrong DRY_RUN: expected boolean, got \"yes\""+
+			"\n  - wrong OUTPUT_SINKS: unknown sink \"ftp\", expected one of: kafka, file, stdout, webhook"+
+			"\n  - empty SECONDARY_DEKANAT_DB_DSN: set connection string of secondary Dekanat DB"+
+			" or SECONDARY_DEKANAT_DB_HOST and SECONDARY_DEKANAT_DB_DATABASE",
+		)
+	})
+
 	t.Run("EmptyNotRequiredParamsConfig", func(t *testing.T) {
 		_ = os.Setenv("DEKANAT_DB_DRIVER_NAME", "")
 		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "dummy")
@@ -97,7 +215,622 @@ func TestLoadConfigFromEnvVars(t *testing.T) {
 			t, "firebirdsql", config.dekanatDbDriverName,
 			"Expected for default firebirdsql driver, actual: %s", config.dekanatDbDriverName,
 		)
+		assert.Empty(t, config.fingerprintsFile)
+		assert.False(t, config.forceImport)
+		assert.Empty(t, config.checkpointsFile)
+		assert.False(t, config.dryRun)
+
+	})
+
+	t.Run("SinkConfig", func(t *testing.T) {
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "dummy")
+		_ = os.Setenv("KAFKA_HOST", "dummy")
+		_ = os.Setenv("OUTPUT_SINK", "webhook")
+		_ = os.Setenv("OUTPUT_WEBHOOK_URL", "https://reports.example.com/disciplines")
+		_ = os.Setenv("OUTPUT_WEBHOOK_BATCH_SIZE", "20")
+		defer os.Unsetenv("OUTPUT_SINK")
+		defer os.Unsetenv("OUTPUT_WEBHOOK_URL")
+		defer os.Unsetenv("OUTPUT_WEBHOOK_BATCH_SIZE")
+
+		config, err := loadConfig("")
+
+		assert.NoError(t, err)
+		assert.Len(t, config.sinks, 1)
+		assert.Equal(t, WebhookSink, config.sinks[0].kind)
+		assert.Equal(t, RequiredSinkPolicy, config.sinks[0].policy)
+		assert.Equal(t, "https://reports.example.com/disciplines", config.sinks[0].webhookUrl)
+		assert.Equal(t, 20, config.sinks[0].webhookBatchSize)
+
+		_ = os.Setenv("OUTPUT_SINK", "ftp")
+		_, err = loadConfig("")
+		assert.EqualError(t, err, `wrong OUTPUT_SINKS: unknown sink "ftp", expected one of: kafka, file, stdout, webhook`)
+	})
+
+	t.Run("MultipleSinksConfig", func(t *testing.T) {
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "dummy")
+		_ = os.Setenv("KAFKA_HOST", "dummy")
+		_ = os.Setenv("OUTPUT_SINKS", "kafka, file")
+		_ = os.Setenv("OUTPUT_FILE", "/var/lib/importer/disciplines.jsonl")
+		_ = os.Setenv("OUTPUT_FILE_POLICY", "best-effort")
+		defer os.Unsetenv("OUTPUT_SINKS")
+		defer os.Unsetenv("OUTPUT_FILE")
+		defer os.Unsetenv("OUTPUT_FILE_POLICY")
+
+		config, err := loadConfig("")
+
+		assert.NoError(t, err)
+		assert.Len(t, config.sinks, 2)
+		assert.Equal(t, KafkaSink, config.sinks[0].kind)
+		assert.Equal(t, RequiredSinkPolicy, config.sinks[0].policy)
+		assert.Equal(t, FileSink, config.sinks[1].kind)
+		assert.Equal(t, BestEffortSinkPolicy, config.sinks[1].policy)
+
+		_ = os.Setenv("OUTPUT_FILE_POLICY", "sometimes")
+		_, err = loadConfig("")
+		assert.EqualError(
+			t, err, `wrong OUTPUT_FILE_POLICY: unknown sink policy "sometimes", expected one of: required, best-effort, buffered`,
+		)
+
+		_ = os.Setenv("OUTPUT_FILE_POLICY", "buffered")
+		_ = os.Setenv("OUTPUT_SINKS", "kafka,file,kafka")
+		_, err = loadConfig("")
+		assert.EqualError(t, err, `wrong OUTPUT_SINKS: sink "kafka" is listed several times`)
+	})
+
+	t.Run("LifecycleEventsConfig", func(t *testing.T) {
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "dummy")
+		_ = os.Setenv("KAFKA_HOST", "dummy")
+		_ = os.Setenv("LIFECYCLE_EVENTS", "true")
+		_ = os.Setenv("LIFECYCLE_EVENTS_TOPIC", "disciplines_lifecycle")
+		defer os.Unsetenv("LIFECYCLE_EVENTS")
+		defer os.Unsetenv("LIFECYCLE_EVENTS_TOPIC")
+
+		config, err := loadConfig("")
+
+		assert.NoError(t, err)
+		assert.True(t, config.lifecycleEvents)
+		assert.Equal(t, "disciplines_lifecycle", config.lifecycleTopic)
+	})
+
+	t.Run("HeadersConfig", func(t *testing.T) {
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "dummy")
+		_ = os.Setenv("KAFKA_HOST", "dummy")
+		_ = os.Setenv("SOURCE_DB_IDENTITY", "dekanat-mirror-1")
+		_ = os.Setenv("TRACING_ENABLED", "true")
+		defer os.Unsetenv("SOURCE_DB_IDENTITY")
+		defer os.Unsetenv("TRACING_ENABLED")
+
+		config, err := loadConfig("")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "dekanat-mirror-1", config.sourceDbIdentity)
+		assert.True(t, config.tracing)
+	})
+
+	t.Run("WriteRetryConfig", func(t *testing.T) {
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "dummy")
+		_ = os.Setenv("KAFKA_HOST", "dummy")
+		_ = os.Setenv("WRITE_RETRY_INITIAL_DELAY", "1s")
+		_ = os.Setenv("WRITE_RETRY_MAX_DELAY", "30s")
+		_ = os.Setenv("WRITE_RETRY_MAX_DURATION", "0")
+		defer os.Unsetenv("WRITE_RETRY_INITIAL_DELAY")
+		defer os.Unsetenv("WRITE_RETRY_MAX_DELAY")
+		defer os.Unsetenv("WRITE_RETRY_MAX_DURATION")
+
+		config, err := loadConfig("")
+
+		assert.NoError(t, err)
+		assert.Equal(t, RetryPolicy{initialDelay: time.Second, maxDelay: time.Second * 30}, config.writeRetry)
+
+		_ = os.Setenv("WRITE_RETRY_MAX_DURATION", "5 minutes")
+		_, err = loadConfig("")
+		assert.EqualError(t, err, `wrong WRITE_RETRY_MAX_DURATION: time: unknown unit " minutes" in duration "5 minutes"`)
+
+		_ = os.Setenv("WRITE_RETRY_MAX_DURATION", "")
+		_ = os.Setenv("WRITE_RETRY_MAX_DELAY", "500ms")
+		_, err = loadConfig("")
+		assert.EqualError(t, err, "WRITE_RETRY_INITIAL_DELAY should be positive and not greater than WRITE_RETRY_MAX_DELAY")
+	})
+
+	t.Run("OutboxConfig", func(t *testing.T) {
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "dummy")
+		_ = os.Setenv("KAFKA_HOST", "dummy")
+		_ = os.Setenv("OUTBOX_DIR", "/var/lib/importer/outbox")
+		_ = os.Setenv("OUTBOX_FLUSH_INTERVAL", "30s")
+		defer os.Unsetenv("OUTBOX_DIR")
+		defer os.Unsetenv("OUTBOX_FLUSH_INTERVAL")
+
+		config, err := loadConfig("")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "/var/lib/importer/outbox", config.outboxDir)
+		assert.Equal(t, time.Second*30, config.outboxFlushInterval)
+
+		_ = os.Setenv("OUTBOX_FLUSH_INTERVAL", "0s")
+		_, err = loadConfig("")
+		assert.EqualError(t, err, "wrong OUTBOX_FLUSH_INTERVAL: should be positive")
+
+		_ = os.Setenv("OUTBOX_FLUSH_INTERVAL", "30s")
+		_ = os.Setenv("OUTPUT_SINKS", "stdout")
+		defer os.Unsetenv("OUTPUT_SINKS")
+		_, err = loadConfig("")
+		assert.EqualError(t, err, "OUTBOX_DIR requires kafka sink in OUTPUT_SINKS")
+	})
+
+	t.Run("BatchConfig", func(t *testing.T) {
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "dummy")
+		_ = os.Setenv("KAFKA_HOST", "dummy")
+		_ = os.Setenv("BATCH_MAX_MESSAGES", "500")
+		_ = os.Setenv("BATCH_MAX_BYTES", "0")
+		_ = os.Setenv("BATCH_LINGER", "2s")
+		defer os.Unsetenv("BATCH_MAX_MESSAGES")
+		defer os.Unsetenv("BATCH_MAX_BYTES")
+		defer os.Unsetenv("BATCH_LINGER")
+
+		config, err := loadConfig("")
+
+		assert.NoError(t, err)
+		assert.Equal(t, BatchPolicy{maxCount: 500, linger: time.Second * 2}, config.batch)
+
+		_ = os.Setenv("BATCH_MAX_MESSAGES", "0")
+		_, err = loadConfig("")
+		assert.EqualError(t, err, `wrong BATCH_MAX_MESSAGES: expected positive number, got "0"`)
+	})
+
+	t.Run("ProducerConfig", func(t *testing.T) {
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "dummy")
+		_ = os.Setenv("KAFKA_HOST", "dummy")
+		_ = os.Setenv("KAFKA_PRODUCER_COMPRESSION", "lz4")
+		_ = os.Setenv("KAFKA_PRODUCER_ACKS", "one")
+		_ = os.Setenv("KAFKA_PRODUCER_ASYNC", "true")
+		_ = os.Setenv("KAFKA_PRODUCER_WRITE_TIMEOUT", "30s")
+		_ = os.Setenv("KAFKA_PRODUCER_BATCH_TIMEOUT", "50ms")
+		_ = os.Setenv("KAFKA_PRODUCER_BALANCER", "murmur2")
+		defer os.Unsetenv("KAFKA_PRODUCER_COMPRESSION")
+		defer os.Unsetenv("KAFKA_PRODUCER_ACKS")
+		defer os.Unsetenv("KAFKA_PRODUCER_ASYNC")
+		defer os.Unsetenv("KAFKA_PRODUCER_WRITE_TIMEOUT")
+		defer os.Unsetenv("KAFKA_PRODUCER_BATCH_TIMEOUT")
+		defer os.Unsetenv("KAFKA_PRODUCER_BALANCER")
+
+		config, err := loadConfig("")
+
+		assert.NoError(t, err)
+		assert.Equal(t, ProducerConfig{
+			compression:  kafka.Lz4,
+			requiredAcks: kafka.RequireOne,
+			async:        true,
+			writeTimeout: time.Second * 30,
+			batchTimeout: time.Millisecond * 50,
+			balancer:     Murmur2Balancer,
+		}, config.producer)
+
+		_ = os.Setenv("OUTBOX_DIR", "/var/lib/importer/outbox")
+		_, err = loadConfig("")
+		assert.EqualError(t, err, "KAFKA_PRODUCER_ASYNC can not be used with OUTBOX_DIR")
+		_ = os.Unsetenv("OUTBOX_DIR")
+
+		_ = os.Setenv("FINGERPRINTS_FILE", "/var/lib/importer/fingerprints.json")
+		_ = os.Setenv("CHECKPOINTS_FILE", "/var/lib/importer/checkpoints.json")
+		_, err = loadConfig("")
+		assert.EqualError(t, err, "2 problems:"+
+			"\n  - KAFKA_PRODUCER_ASYNC can not be used with FINGERPRINTS_FILE"+
+			"\n  - KAFKA_PRODUCER_ASYNC can not be used with CHECKPOINTS_FILE",
+		)
+		_ = os.Unsetenv("FINGERPRINTS_FILE")
+		_ = os.Unsetenv("CHECKPOINTS_FILE")
+
+		_ = os.Setenv("KAFKA_PRODUCER_BALANCER", "random")
+		_, err = loadConfig("")
+		assert.EqualError(
+			t, err, `wrong KAFKA_PRODUCER_BALANCER: unknown balancer "random", expected one of: least-bytes, round-robin, hash, crc32, murmur2`,
+		)
+
+		_ = os.Setenv("KAFKA_PRODUCER_ACKS", "two")
+		_ = os.Setenv("KAFKA_PRODUCER_COMPRESSION", "brotli")
+		_, err = loadConfig("")
+		assert.EqualError(t, err, "3 problems:"+
+			"\n  - wrong KAFKA_PRODUCER_COMPRESSION: unknown codec \"brotli\", expected one of: none, gzip, snappy, lz4, zstd"+
+			"\n  - wrong KAFKA_PRODUCER_ACKS: unknown value \"two\", expected one of: none, one, all"+
+			"\n  - wrong KAFKA_PRODUCER_BALANCER: unknown balancer \"random\", expected one of: least-bytes, round-robin, hash, crc32, murmur2",
+		)
+	})
+
+	t.Run("KafkaSecurityConfig", func(t *testing.T) {
+		certFile, keyFile := writeTestCertificate(t, t.TempDir())
+
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "dummy")
+		_ = os.Setenv("KAFKA_HOST", "dummy")
+		_ = os.Setenv("KAFKA_TLS_CA_FILE", certFile)
+		_ = os.Setenv("KAFKA_TLS_CERT_FILE", certFile)
+		_ = os.Setenv("KAFKA_TLS_KEY_FILE", keyFile)
+		_ = os.Setenv("KAFKA_TLS_SERVER_NAME", "kafka.example.com")
+		_ = os.Setenv("KAFKA_SASL_MECHANISM", "scram-sha-512")
+		_ = os.Setenv("KAFKA_SASL_USERNAME", "importer")
+		_ = os.Setenv("KAFKA_SASL_PASSWORD", "secret")
+		defer os.Unsetenv("KAFKA_TLS_CA_FILE")
+		defer os.Unsetenv("KAFKA_TLS_CERT_FILE")
+		defer os.Unsetenv("KAFKA_TLS_KEY_FILE")
+		defer os.Unsetenv("KAFKA_TLS_SERVER_NAME")
+		defer os.Unsetenv("KAFKA_SASL_MECHANISM")
+		defer os.Unsetenv("KAFKA_SASL_USERNAME")
+		defer os.Unsetenv("KAFKA_SASL_PASSWORD")
+
+		config, err := loadConfig("")
+
+		assert.NoError(t, err)
+		assert.Equal(t, KafkaSecurityConfig{
+			tlsEnabled:    true,
+			tlsCaFile:     certFile,
+			tlsCertFile:   certFile,
+			tlsKeyFile:    keyFile,
+			tlsServerName: "kafka.example.com",
+			saslMechanism: SaslScramSha512,
+			saslUsername:  "importer",
+			saslPassword:  "secret",
+		}, config.kafkaSecurity)
+
+		_ = os.Setenv("KAFKA_SASL_PASSWORD", "")
+		_, err = loadConfig("")
+		assert.EqualError(t, err, "KAFKA_SASL_USERNAME and KAFKA_SASL_PASSWORD are required by KAFKA_SASL_MECHANISM")
+
+		_ = os.Setenv("KAFKA_TLS_ENABLED", "maybe")
+		defer os.Unsetenv("KAFKA_TLS_ENABLED")
+		_, err = loadConfig("")
+		assert.EqualError(t, err, `wrong KAFKA_TLS_ENABLED: expected boolean, got "maybe"`)
+	})
+
+	t.Run("SecretFilesConfig", func(t *testing.T) {
+		dir := t.TempDir()
+		_ = os.WriteFile(dir+"/dsn", []byte("USER:PASSOWORD@HOST/DATABASE\n"), 0600)
+		_ = os.WriteFile(dir+"/sasl-password", []byte("secret"), 0600)
+
+		_ = os.Setenv("KAFKA_HOST", "dummy")
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "")
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN_FILE", dir+"/dsn")
+		_ = os.Setenv("KAFKA_SASL_MECHANISM", "plain")
+		_ = os.Setenv("KAFKA_SASL_USERNAME", "importer")
+		_ = os.Setenv("KAFKA_SASL_PASSWORD_FILE", dir+"/sasl-password")
+		defer os.Unsetenv("SECONDARY_DEKANAT_DB_DSN_FILE")
+		defer os.Unsetenv("KAFKA_SASL_MECHANISM")
+		defer os.Unsetenv("KAFKA_SASL_USERNAME")
+		defer os.Unsetenv("KAFKA_SASL_PASSWORD_FILE")
+
+		config, err := loadConfig("")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "USER:PASSOWORD@HOST/DATABASE", config.secondaryDekanatDbDSN)
+		assert.Equal(t, "secret", config.kafkaSecurity.saslPassword)
+
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "dummy")
+		_ = os.Setenv("KAFKA_SASL_PASSWORD_FILE", dir+"/missing")
+		_, err = loadConfig("")
+		assert.EqualError(
+			t, err, "2 problems:"+
+				"\n  - only one of SECONDARY_DEKANAT_DB_DSN and SECONDARY_DEKANAT_DB_DSN_FILE can be set"+
+				"\n  - wrong KAFKA_SASL_PASSWORD_FILE: open "+dir+"/missing: no such file or directory",
+		)
+	})
+
+	t.Run("DbConnectionConfig", func(t *testing.T) {
+		dir := t.TempDir()
+		_ = os.WriteFile(dir+"/password", []byte("pass@word\n"), 0600)
+
+		_ = os.Setenv("KAFKA_HOST", "dummy")
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "")
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_HOST", "db")
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_PORT", "3050")
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DATABASE", "/var/lib/firebird/dekanat.fdb")
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_USER", "importer")
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_PASSWORD_FILE", dir+"/password")
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_CHARSET", "WIN1251")
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_ROLE", "READER")
+		defer os.Unsetenv("SECONDARY_DEKANAT_DB_HOST")
+		defer os.Unsetenv("SECONDARY_DEKANAT_DB_PORT")
+		defer os.Unsetenv("SECONDARY_DEKANAT_DB_DATABASE")
+		defer os.Unsetenv("SECONDARY_DEKANAT_DB_USER")
+		defer os.Unsetenv("SECONDARY_DEKANAT_DB_PASSWORD_FILE")
+		defer os.Unsetenv("SECONDARY_DEKANAT_DB_CHARSET")
+		defer os.Unsetenv("SECONDARY_DEKANAT_DB_ROLE")
+
+		config, err := loadConfig("")
+
+		assert.NoError(t, err)
+		assert.Equal(
+			t, "importer:pass%40word@db:3050/var/lib/firebird/dekanat.fdb?charset=WIN1251&role=READER",
+			config.secondaryDekanatDbDSN,
+		)
+		assert.Equal(t, "pass@word", config.dbConnection.password)
+		assert.Equal(t, "firebirdsql:db:3050/var/lib/firebird/dekanat.fdb", config.sourceDbIdentity)
+
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "dummy")
+		_, err = loadConfig("")
+		assert.EqualError(
+			t, err,
+			"SECONDARY_DEKANAT_DB_DSN can not be used with SECONDARY_DEKANAT_DB_HOST, _DATABASE and other connection settings",
+		)
+
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "")
+		_ = os.Setenv("DEKANAT_DB_DRIVER_NAME", "mysql")
+		defer os.Unsetenv("DEKANAT_DB_DRIVER_NAME")
+		_, err = loadConfig("")
+		assert.EqualError(t, err, "SECONDARY_DEKANAT_DB_ROLE is not supported by mysql driver")
+
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_ROLE", "")
+		config, err = loadConfig("")
+		assert.NoError(t, err)
+		assert.Contains(t, config.secondaryDekanatDbDSN, "loc=Local")
+
+		for _, name := range []string{"HOST", "PORT", "DATABASE", "USER", "PASSWORD_FILE", "CHARSET"} {
+			_ = os.Unsetenv("SECONDARY_DEKANAT_DB_" + name)
+		}
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "importer:secret@tcp(db:3306)/dekanat")
+		_, err = loadConfig("")
+		assert.EqualError(t, err, "SECONDARY_DEKANAT_DB_DSN of mysql driver requires loc=Local: datetime is bound as local time")
+
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "importer:secret@tcp(db:3306)/dekanat?loc=Local")
+		_, err = loadConfig("")
+		assert.NoError(t, err)
+	})
+
+	t.Run("TopicsConfig", func(t *testing.T) {
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "dummy")
+		_ = os.Setenv("KAFKA_HOST", "kafka-1:9092, kafka-2:9092,kafka-3:9092")
+		_ = os.Setenv("KAFKA_TOPIC_PREFIX", "staging.")
+		defer os.Unsetenv("KAFKA_TOPIC_PREFIX")
+
+		config, err := loadConfig("")
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"kafka-1:9092", "kafka-2:9092", "kafka-3:9092"}, config.kafkaBrokers)
+		assert.Equal(t, "staging."+events.DisciplinesTopic, config.disciplinesTopic)
+		assert.Equal(t, "staging."+events.DisciplinesTopic, config.sinks[0].kafkaTopic)
+		assert.Equal(t, "staging."+events.MetaEventsTopic, config.metaEventsTopic)
+		assert.Equal(t, "staging."+events.MetaEventsTopic, config.lifecycleTopic)
+		assert.Equal(t, "staging.secondary-db-disciplines-importer", config.consumerGroupId)
+
+		_ = os.Setenv("DISCIPLINES_TOPIC", "faculty-disciplines")
+		_ = os.Setenv("META_EVENTS_TOPIC", "faculty-meta-events")
+		_ = os.Setenv("KAFKA_CONSUMER_GROUP_ID", "faculty-importer")
+		defer os.Unsetenv("DISCIPLINES_TOPIC")
+		defer os.Unsetenv("META_EVENTS_TOPIC")
+		defer os.Unsetenv("KAFKA_CONSUMER_GROUP_ID")
+
+		config, err = loadConfig("")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "faculty-disciplines", config.disciplinesTopic)
+		assert.Equal(t, "faculty-meta-events", config.metaEventsTopic)
+		assert.Equal(t, "faculty-meta-events", config.lifecycleTopic)
+		assert.Equal(t, "faculty-importer", config.consumerGroupId)
+
+		_ = os.Setenv("KAFKA_HOST", "kafka-1:9092,,kafka-3:9092")
+		_, err = loadConfig("")
+		assert.EqualError(t, err, `wrong KAFKA_HOST: empty broker address in "kafka-1:9092,,kafka-3:9092"`)
+		_ = os.Setenv("KAFKA_HOST", "dummy")
+	})
+
+	t.Run("DryRunConfig", func(t *testing.T) {
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "dummy")
+		_ = os.Setenv("KAFKA_HOST", "dummy")
+		_ = os.Setenv("DRY_RUN", "true")
+		_ = os.Setenv("DRY_RUN_OUTPUT", "/tmp/dry-run.jsonl")
+		defer os.Unsetenv("DRY_RUN")
+		defer os.Unsetenv("DRY_RUN_OUTPUT")
+
+		config, err := loadConfig("")
+
+		assert.NoError(t, err)
+		assert.True(t, config.dryRun)
+		assert.Equal(t, "/tmp/dry-run.jsonl", config.dryRunOutput)
+		assert.Equal(t, "secondary-db-disciplines-importer-dry-run", config.consumerGroupId)
+
+		_ = os.Setenv("KAFKA_CONSUMER_GROUP_ID", "importer")
+		defer os.Unsetenv("KAFKA_CONSUMER_GROUP_ID")
+		config, err = loadConfig("")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "importer-dry-run", config.consumerGroupId, "dry run never joins group of real importer")
+	})
+
+	t.Run("ChangeDetectionConfig", func(t *testing.T) {
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "dummy")
+		_ = os.Setenv("KAFKA_HOST", "dummy")
+		_ = os.Setenv("FINGERPRINTS_FILE", "/var/lib/importer/fingerprints.json")
+		_ = os.Setenv("FORCE_IMPORT", "true")
+		_ = os.Setenv("CHECKPOINTS_FILE", "/var/lib/importer/checkpoints.json")
+		defer os.Unsetenv("CHECKPOINTS_FILE")
+		defer os.Unsetenv("FINGERPRINTS_FILE")
+		defer os.Unsetenv("FORCE_IMPORT")
+
+		config, err := loadConfig("")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "/var/lib/importer/fingerprints.json", config.fingerprintsFile)
+		assert.True(t, config.forceImport)
+		assert.Equal(t, "/var/lib/importer/checkpoints.json", config.checkpointsFile)
+	})
+
+	t.Run("EnrichmentConfig", func(t *testing.T) {
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "dummy")
+		_ = os.Setenv("KAFKA_HOST", "dummy")
+		_ = os.Setenv("DISCIPLINES_ENRICHMENT_LECTURER", "T_PREP.FIO")
+		_ = os.Setenv("DISCIPLINES_ENRICHMENT_JOINS", "LEFT JOIN T_PREP ON T_PREP.ID = T_PD_CMS.PREP_ID")
+		defer os.Unsetenv("DISCIPLINES_ENRICHMENT_LECTURER")
+		defer os.Unsetenv("DISCIPLINES_ENRICHMENT_JOINS")
+		defer os.Unsetenv("DISCIPLINES_PAYLOAD_VERSION")
+
+		config, err := loadConfig("")
+
+		assert.Error(t, err)
+		assert.Equal(t, "wrong disciplines query: field lecturer requires payload version 2", err.Error())
+
+		_ = os.Setenv("DISCIPLINES_PAYLOAD_VERSION", "2")
+		config, err = loadConfig("")
+
+		assert.NoError(t, err)
+		assert.Equal(t, DisciplinePayloadVersion2, config.payloadVersion)
+		assert.Contains(t, config.query.Query, "T_PREP.FIO AS LECTURER")
+		assert.Contains(t, config.query.Query, "LEFT JOIN T_PREP ON T_PREP.ID = T_PD_CMS.PREP_ID")
+		assert.Equal(t, LecturerField, config.query.Columns["LECTURER"])
+		assert.Equal(t, DisciplineEnrichment{
+			Joins: "LEFT JOIN T_PREP ON T_PREP.ID = T_PD_CMS.PREP_ID", Lecturer: "T_PREP.FIO",
+		}, config.enrichment)
+
+		_ = os.Setenv("DISCIPLINES_PAYLOAD_VERSION", "3")
+		config, err = loadConfig("")
+
+		assert.Error(t, err)
+		assert.Equal(t, "wrong DISCIPLINES_PAYLOAD_VERSION: unsupported payload version 3, expected 1 or 2", err.Error())
+
+		_ = os.Setenv("DISCIPLINES_PAYLOAD_VERSION", "2")
+		_ = os.Setenv("DISCIPLINES_QUERY_FILE", "query.yaml")
+		defer os.Unsetenv("DISCIPLINES_QUERY_FILE")
+		config, err = loadConfig("")
+
+		assert.Error(t, err)
+		assert.Equal(t, "DISCIPLINES_ENRICHMENT_* settings can not be used with DISCIPLINES_QUERY_FILE", err.Error())
+	})
+
+	t.Run("QueryFileConfig", func(t *testing.T) {
+		queryFilename := filepath.Join(t.TempDir(), "query.yaml")
+		_ = os.WriteFile(queryFilename, []byte(testQueryFileContent), 0644)
+
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "dummy")
+		_ = os.Setenv("KAFKA_HOST", "dummy")
+		_ = os.Setenv("DISCIPLINES_PAYLOAD_VERSION", "2")
+		_ = os.Setenv("DISCIPLINES_QUERY_FILE", queryFilename)
+		defer os.Unsetenv("DISCIPLINES_PAYLOAD_VERSION")
+		defer os.Unsetenv("DISCIPLINES_QUERY_FILE")
+
+		config, err := loadConfig("")
+
+		assert.NoError(t, err)
+		assert.Equal(t, queryFilename, config.queryFile)
+		assert.Equal(t, []string{YearParam, StartDatetimeParam, EndDatetimeParam}, config.query.Params)
+		assert.Equal(t, SemesterField, config.query.Columns["SEMESTR"])
+
+		_ = os.Setenv("DISCIPLINES_PAYLOAD_VERSION", "1")
+		config, err = loadConfig("")
+
+		assert.Error(t, err)
+		assert.Equal(t, "wrong disciplines query: field semester requires payload version 2", err.Error())
+
+		_ = os.Setenv("DISCIPLINES_QUERY_FILE", queryFilename+".not-exists")
+		config, err = loadConfig("")
+
+		assert.Error(t, err)
+		assert.ErrorContains(t, err, "wrong DISCIPLINES_QUERY_FILE: open ")
+	})
+
+	t.Run("DialectConfig", func(t *testing.T) {
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "dummy")
+		_ = os.Setenv("KAFKA_HOST", "dummy")
+		_ = os.Setenv("DEKANAT_DB_DRIVER_NAME", "postgres")
+		defer os.Unsetenv("DEKANAT_DB_DRIVER_NAME")
+		defer os.Unsetenv("DEKANAT_DB_DIALECT")
+
+		config, err := loadConfig("")
+
+		assert.NoError(t, err)
+		assert.Equal(t, PostgresDialect, config.dialect)
+		assert.Contains(t, config.query.Query, `SELECT "T_PD_CMS"."ID", "TPR_COLL"."PREDMET" FROM "T_PD_CMS"`)
+
+		_ = os.Setenv("DEKANAT_DB_DIALECT", "mysql")
+		config, err = loadConfig("")
+
+		assert.NoError(t, err)
+		assert.Equal(t, MysqlDialect, config.dialect)
+
+		_ = os.Setenv("DEKANAT_DB_DIALECT", "postgres")
+		_ = os.Setenv("DEKANAT_DB_QUOTE_IDENTIFIERS", "false")
+		config, err = loadConfig("")
+		_ = os.Unsetenv("DEKANAT_DB_QUOTE_IDENTIFIERS")
+
+		assert.NoError(t, err)
+		assert.Contains(t, config.query.Query, `SELECT T_PD_CMS.ID, TPR_COLL.PREDMET FROM T_PD_CMS`)
+
+		_ = os.Setenv("DEKANAT_DB_DIALECT", "oracle")
+		config, err = loadConfig("")
+
+		assert.EqualError(t, err, `wrong DEKANAT_DB_DIALECT: unknown SQL dialect "oracle"`)
+	})
+
+	t.Run("NameNormalizationConfig", func(t *testing.T) {
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "dummy")
+		_ = os.Setenv("KAFKA_HOST", "dummy")
+		_ = os.Setenv("DISCIPLINES_NAME_NORMALIZERS", "whitespace,capitalize")
+		_ = os.Setenv("DISCIPLINES_KEEP_RAW_NAME", "true")
+		defer os.Unsetenv("DISCIPLINES_NAME_NORMALIZERS")
+		defer os.Unsetenv("DISCIPLINES_KEEP_RAW_NAME")
+		defer os.Unsetenv("DISCIPLINES_PAYLOAD_VERSION")
+
+		config, err := loadConfig("")
+		assert.EqualError(t, err, "DISCIPLINES_KEEP_RAW_NAME requires DISCIPLINES_PAYLOAD_VERSION=2")
+
+		_ = os.Setenv("DISCIPLINES_PAYLOAD_VERSION", "2")
+		config, err = loadConfig("")
+
+		assert.NoError(t, err)
+		assert.Equal(t, NameNormalizer{"whitespace", "capitalize"}, config.nameNormalizer)
+		assert.True(t, config.keepRawName)
+
+		_ = os.Setenv("DISCIPLINES_NAME_NORMALIZERS", "translit")
+		config, err = loadConfig("")
+		assert.EqualError(t, err, `wrong DISCIPLINES_NAME_NORMALIZERS: unknown name normalizer "translit"`)
+	})
+
+	t.Run("DeadLetterConfig", func(t *testing.T) {
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "dummy")
+		_ = os.Setenv("KAFKA_HOST", "dummy")
+		_ = os.Setenv("DEAD_LETTER_TOPIC", "disciplines_dead_letter")
+		_ = os.Setenv("DEAD_LETTER_MAX_ROWS", "5")
+		defer os.Unsetenv("DEAD_LETTER_TOPIC")
+		defer os.Unsetenv("DEAD_LETTER_FILE")
+		defer os.Unsetenv("DEAD_LETTER_MAX_ROWS")
+
+		config, err := loadConfig("")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "disciplines_dead_letter", config.deadLetterTopic)
+		assert.Equal(t, 5, config.maxInvalidRows)
+
+		_ = os.Setenv("DEAD_LETTER_FILE", "dead-letter.jsonl")
+		config, err = loadConfig("")
+		assert.EqualError(t, err, "only one of DEAD_LETTER_TOPIC and DEAD_LETTER_FILE can be set")
+	})
+
+	t.Run("WrongKeyMode", func(t *testing.T) {
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "dummy")
+		_ = os.Setenv("KAFKA_HOST", "dummy")
+		_ = os.Setenv("DISCIPLINES_KEY_MODE", "random")
+		defer os.Unsetenv("DISCIPLINES_KEY_MODE")
+
+		config, err := loadConfig("")
+
+		assert.Error(t, err, "loadConfig() should exit with error, actual error is nil")
+		assert.Equal(t, `wrong DISCIPLINES_KEY_MODE: unknown message key mode "random"`, err.Error())
+		assert.Empty(t, config.kafkaBrokers)
+
+		_ = os.Setenv("DISCIPLINES_KEY_MODE", "discipline")
+		config, err = loadConfig("")
+
+		assert.NoError(t, err)
+		assert.Equal(t, DisciplineKeyMode, config.keyMode)
+		assert.Equal(t, HashBalancer, config.producer.balancer, "key hash balancer is default of discipline key mode")
+
+		_ = os.Setenv("KAFKA_PRODUCER_BALANCER", "least-bytes")
+		defer os.Unsetenv("KAFKA_PRODUCER_BALANCER")
+		_, err = loadConfig("")
+		assert.EqualError(
+			t, err, "KAFKA_PRODUCER_BALANCER=least-bytes can not be used with DISCIPLINES_KEY_MODE=discipline: "+
+				"versions and tombstones of a discipline should land into one partition of compacted topic, use hash, crc32 or murmur2",
+		)
 
+		_ = os.Setenv("KAFKA_PRODUCER_BALANCER", "crc32")
+		config, err = loadConfig("")
+		assert.NoError(t, err)
+		assert.Equal(t, Crc32Balancer, config.producer.balancer)
 	})
 
 	t.Run("NotExistConfigFile", func(t *testing.T) {
@@ -117,10 +850,34 @@ func TestLoadConfigFromEnvVars(t *testing.T) {
 	})
 }
 
+func TestConfigWarnings(t *testing.T) {
+	config := expectedConfig
+	assert.Equal(t, []string{
+		"retried writes may publish duplicates, consumers can drop them only with " +
+			"DISCIPLINES_KEY_MODE=discipline and KAFKA_PRODUCER_BALANCER=hash, crc32 or murmur2",
+	}, config.warnings())
+
+	config.keyMode = DisciplineKeyMode
+	assert.Len(t, config.warnings(), 1, "least-bytes balancer spreads duplicates of a key across partitions")
+
+	config.producer.balancer = Murmur2Balancer
+	assert.Empty(t, config.warnings())
+
+	config.keyMode = LegacyKeyMode
+	config.writeRetry.maxDuration = 0
+	assert.Empty(t, config.warnings(), "writes are not retried")
+
+	config.outboxDir = "/var/lib/importer/outbox"
+	assert.Len(t, config.warnings(), 1, "spilled writes are retried")
+
+	config.sinks = []SinkConfig{{kind: FileSink, policy: RequiredSinkPolicy}}
+	assert.Empty(t, config.warnings(), "duplicates are not published to Kafka")
+}
+
 func assertConfig(t *testing.T, expected Config, actual Config) {
 	assert.Equalf(
-		t, expected.kafkaHost, actual.kafkaHost,
-		"Expected for Kafka Host: %s, actual %s", expected.kafkaHost, actual.kafkaHost,
+		t, expected.kafkaBrokers, actual.kafkaBrokers,
+		"Expected for Kafka Brokers: %v, actual %v", expected.kafkaBrokers, actual.kafkaBrokers,
 	)
 
 	assert.Equalf(
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigSource resolves settings by env variable names: not empty env variable overrides value of config file.
+// Nested keys of config file are joined by underscore, e.g. kafka.host is KAFKA_HOST, lists are joined by comma.
+type ConfigSource struct {
+	filename string
+	file     map[string]string
+	// used lists requested settings, other settings of config file are unknown
+	used map[string]bool
+}
+
+func NewConfigSource(filename string) (*ConfigSource, error) {
+	source := &ConfigSource{filename: filename, file: map[string]string{}, used: map[string]bool{}}
+	if filename == "" {
+		return source, nil
+	}
+
+	var unmarshal func([]byte, any) error
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		unmarshal = yaml.Unmarshal
+	case ".toml":
+		unmarshal = toml.Unmarshal
+	default:
+		return nil, fmt.Errorf("unknown format of %s, expected .yaml, .yml or .toml file", filename)
+	}
+
+	var values map[string]any
+	content, err := os.ReadFile(filename)
+	if err == nil {
+		err = unmarshal(content, &values)
+	}
+	if err == nil {
+		err = flattenConfigValues("", values, source.file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return source, nil
+}
+
+func flattenConfigValues(prefix string, values map[string]any, settings map[string]string) error {
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		name := strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+
+		var value string
+		switch typed := values[key].(type) {
+		case map[string]any:
+			if err := flattenConfigValues(name, typed, settings); err != nil {
+				return err
+			}
+			continue
+
+		case []any:
+			items := make([]string, len(typed))
+			for i, item := range typed {
+				var isScalar bool
+				if items[i], isScalar = configScalar(item); !isScalar {
+					return fmt.Errorf("setting %s should be list of values", name)
+				}
+			}
+			value = strings.Join(items, ",")
+
+		default:
+			var isScalar bool
+			if value, isScalar = configScalar(typed); !isScalar {
+				return fmt.Errorf("setting %s has unsupported value %v", name, typed)
+			}
+		}
+
+		if _, exists := settings[name]; exists {
+			return fmt.Errorf("setting %s is set several times", name)
+		}
+		settings[name] = value
+	}
+
+	return nil
+}
+
+func configScalar(value any) (string, bool) {
+	switch value.(type) {
+	case nil:
+		return "", true
+	case string, bool, int, int64, uint64, float64:
+		return fmt.Sprint(value), true
+	}
+
+	return "", false
+}
+
+func (source *ConfigSource) get(name string) string {
+	source.used[name] = true
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+
+	return source.file[name]
+}
+
+// secret reads setting or content of file set by NAME_FILE setting, e.g. mounted Docker or Kubernetes secret.
+func (source *ConfigSource) secret(name string) (string, error) {
+	value, filename := source.get(name), source.get(name+"_FILE")
+	if filename == "" {
+		return value, nil
+	}
+
+	if value != "" {
+		return "", fmt.Errorf("only one of %s and %s_FILE can be set", name, name)
+	}
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return "", errors.New("wrong " + name + "_FILE: " + err.Error())
+	}
+
+	// secret files usually end with newline, which is not part of secret
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// getOrDefault returns defaultValue for empty setting.
+func (source *ConfigSource) getOrDefault(name string, defaultValue string) string {
+	if value := source.get(name); value != "" {
+		return value
+	}
+
+	return defaultValue
+}
+
+func (source *ConfigSource) bool(name string, defaultValue bool) (bool, error) {
+	value := source.get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return defaultValue, fmt.Errorf("wrong %s: expected boolean, got %q", name, value)
+	}
+
+	return parsed, nil
+}
+
+// int parses number not less than minValue, which is 0 or 1.
+func (source *ConfigSource) int(name string, defaultValue int, minValue int) (int, error) {
+	value := source.get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < minValue {
+		expected := "not negative number"
+		if minValue > 0 {
+			expected = "positive number"
+		}
+		return defaultValue, fmt.Errorf("wrong %s: expected %s, got %q", name, expected, value)
+	}
+
+	return parsed, nil
+}
+
+// duration parses value like "500ms" or "1m".
+func (source *ConfigSource) duration(name string, defaultValue time.Duration) (time.Duration, error) {
+	value := source.get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err == nil && duration < 0 {
+		err = errors.New("negative duration")
+	}
+	if err != nil {
+		return defaultValue, errors.New("wrong " + name + ": " + err.Error())
+	}
+
+	return duration, nil
+}
+
+// timeout parses positive duration, number without unit is count of seconds.
+func (source *ConfigSource) timeout(name string, defaultValue time.Duration) (time.Duration, error) {
+	value := source.get(name)
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Second * time.Duration(seconds), nil
+	}
+
+	timeout, err := source.duration(name, defaultValue)
+	if err == nil && timeout == 0 {
+		err = errors.New("wrong " + name + ": should be positive")
+	}
+	if err != nil {
+		return defaultValue, fmt.Errorf("%w, expected duration like \"10s\" or number of seconds", err)
+	}
+
+	return timeout, nil
+}
+
+// unknownSettings reports settings of config file which were never requested, e.g. misspelled ones.
+func (source *ConfigSource) unknownSettings() error {
+	var problems ConfigProblems
+	for _, name := range slices.Sorted(maps.Keys(source.file)) {
+		if !source.used[name] {
+			problems.add(fmt.Errorf("unknown setting %s in %s, check spelling of its key", name, source.filename))
+		}
+	}
+
+	return problems.err()
+}
+
+// ConfigProblems collects every config problem to report them at once.
+type ConfigProblems []error
+
+// add appends err; errors joined by errors.Join or ConfigError are appended one by one.
+func (problems *ConfigProblems) add(err error) {
+	if joined, isJoined := err.(interface{ Unwrap() []error }); isJoined {
+		for _, problem := range joined.Unwrap() {
+			problems.add(problem)
+		}
+	} else if err != nil {
+		*problems = append(*problems, err)
+	}
+}
+
+func (problems ConfigProblems) err() error {
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return ConfigError{problems: problems}
+}
+
+// ConfigError lists all problems of config; single problem is reported as is.
+type ConfigError struct {
+	problems []error
+}
+
+func (err ConfigError) Error() string {
+	if len(err.problems) == 1 {
+		return err.problems[0].Error()
+	}
+
+	message := fmt.Sprintf("%d problems:", len(err.problems))
+	for _, problem := range err.problems {
+		message += "\n  - " + problem.Error()
+	}
+
+	return message
+}
+
+func (err ConfigError) Unwrap() []error {
+	return err.problems
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewConfigSource(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("yaml", func(t *testing.T) {
+		filename := filepath.Join(dir, "config.yaml")
+		_ = os.WriteFile(filename, []byte(`
+kafka:
+  host: [kafka-1:9092, kafka-2:9092]
+  timeout: 30s
+  producer:
+    async: false
+secondary-dekanat-db-dsn: USER:PASSWORD@HOST/DATABASE
+BATCH_MAX_MESSAGES: 500
+dead_letter_topic:
+`), 0600)
+
+		source, err := NewConfigSource(filename)
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"KAFKA_HOST":               "kafka-1:9092,kafka-2:9092",
+			"KAFKA_TIMEOUT":            "30s",
+			"KAFKA_PRODUCER_ASYNC":     "false",
+			"SECONDARY_DEKANAT_DB_DSN": "USER:PASSWORD@HOST/DATABASE",
+			"BATCH_MAX_MESSAGES":       "500",
+			"DEAD_LETTER_TOPIC":        "",
+		}, source.file)
+	})
+
+	t.Run("toml", func(t *testing.T) {
+		filename := filepath.Join(dir, "config.toml")
+		_ = os.WriteFile(filename, []byte(`
+secondary_dekanat_db_dsn = "USER:PASSWORD@HOST/DATABASE"
+
+[kafka]
+host = "kafka:9092"
+attempts = 3
+
+[output]
+sinks = ["kafka", "file"]
+file = "/var/lib/disciplines.jsonl"
+`), 0600)
+
+		source, err := NewConfigSource(filename)
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"SECONDARY_DEKANAT_DB_DSN": "USER:PASSWORD@HOST/DATABASE",
+			"KAFKA_HOST":               "kafka:9092",
+			"KAFKA_ATTEMPTS":           "3",
+			"OUTPUT_SINKS":             "kafka,file",
+			"OUTPUT_FILE":              "/var/lib/disciplines.jsonl",
+		}, source.file)
+	})
+
+	t.Run("without file", func(t *testing.T) {
+		source, err := NewConfigSource("")
+
+		assert.NoError(t, err)
+		assert.Empty(t, source.file)
+	})
+
+	t.Run("wrong file", func(t *testing.T) {
+		testCases := []struct {
+			name          string
+			content       string
+			expectedError string
+		}{
+			{"config.ini", "[kafka]\nhost = kafka:9092\n", "unknown format of FILENAME, expected .yaml, .yml or .toml file"},
+			{"not-exists.toml", "", "open FILENAME: no such file or directory"},
+			{"duplicate.yaml", "kafka: {host: kafka:9092}\nKAFKA_HOST: kafka:9093\n", "setting KAFKA_HOST is set several times"},
+			{"nested-list.yaml", "output: {sinks: [{kind: kafka}]}\n", "setting OUTPUT_SINKS should be list of values"},
+			{"not-closed.yaml", "kafka: [kafka:9092\n", "yaml: line 1: did not find expected ',' or ']'"},
+		}
+
+		for _, testCase := range testCases {
+			filename := filepath.Join(dir, testCase.name)
+			if testCase.content != "" {
+				_ = os.WriteFile(filename, []byte(testCase.content), 0600)
+			}
+
+			_, err := NewConfigSource(filename)
+			assert.EqualError(t, err, strings.ReplaceAll(testCase.expectedError, "FILENAME", filename), testCase.name)
+		}
+	})
+}
+
+func TestConfigSourceGet(t *testing.T) {
+	source := &ConfigSource{
+		filename: "config.yaml",
+		file:     map[string]string{"TEST_HOST": "kafka:9092", "TEST_TIMEOUT": "30s", "TEST_HOTS": "typo"},
+		used:     map[string]bool{},
+	}
+
+	_ = os.Setenv("TEST_TIMEOUT", "5")
+	defer os.Unsetenv("TEST_TIMEOUT")
+
+	assert.Equal(t, "kafka:9092", source.get("TEST_HOST"))
+	assert.Equal(t, "5", source.get("TEST_TIMEOUT"), "env variable overrides config file")
+	assert.Equal(t, "default", source.getOrDefault("TEST_PREFIX", "default"))
+
+	assert.EqualError(t, source.unknownSettings(), "unknown setting TEST_HOTS in config.yaml, check spelling of its key")
+}
+
+func TestConfigSourceSecret(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "password")
+	_ = os.WriteFile(secretFile, []byte("s3cret\n"), 0600)
+
+	source := &ConfigSource{
+		filename: "config.yaml",
+		file:     map[string]string{"TEST_PASSWORD_FILE": secretFile, "TEST_TOKEN": "token"},
+		used:     map[string]bool{},
+	}
+
+	value, err := source.secret("TEST_PASSWORD")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", value, "trailing newline of secret file is trimmed")
+
+	value, err = source.secret("TEST_TOKEN")
+	assert.NoError(t, err)
+	assert.Equal(t, "token", value)
+	assert.NoError(t, source.unknownSettings())
+
+	_ = os.Setenv("TEST_TOKEN_FILE", filepath.Join(t.TempDir(), "missing"))
+	defer os.Unsetenv("TEST_TOKEN_FILE")
+	_, err = source.secret("TEST_TOKEN")
+	assert.EqualError(t, err, "only one of TEST_TOKEN and TEST_TOKEN_FILE can be set")
+
+	source.file["TEST_TOKEN"] = ""
+	_, err = source.secret("TEST_TOKEN")
+	assert.ErrorContains(t, err, "wrong TEST_TOKEN_FILE: open ")
+}
+
+func TestConfigSourceTypedValues(t *testing.T) {
+	source := &ConfigSource{
+		file: map[string]string{
+			"BOOL":           "true",
+			"WRONG_BOOL":     "yes please",
+			"INT":            "12",
+			"NEGATIVE_INT":   "-1",
+			"ZERO":           "0",
+			"DURATION":       "1m30s",
+			"WRONG_DURATION": "90",
+			"SECONDS":        "90",
+			"NEGATIVE":       "-1s",
+		},
+		used: map[string]bool{},
+	}
+
+	value, err := source.bool("BOOL", false)
+	assert.NoError(t, err)
+	assert.True(t, value)
+
+	value, err = source.bool("EMPTY", true)
+	assert.NoError(t, err)
+	assert.True(t, value)
+
+	_, err = source.bool("WRONG_BOOL", false)
+	assert.EqualError(t, err, `wrong WRONG_BOOL: expected boolean, got "yes please"`)
+
+	number, err := source.int("INT", 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 12, number)
+
+	number, err = source.int("EMPTY", 7, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, number)
+
+	_, err = source.int("NEGATIVE_INT", 0, 0)
+	assert.EqualError(t, err, `wrong NEGATIVE_INT: expected not negative number, got "-1"`)
+
+	_, err = source.int("ZERO", 1, 1)
+	assert.EqualError(t, err, `wrong ZERO: expected positive number, got "0"`)
+
+	duration, err := source.duration("DURATION", time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second*90, duration)
+
+	_, err = source.duration("WRONG_DURATION", time.Second)
+	assert.EqualError(t, err, `wrong WRONG_DURATION: time: missing unit in duration "90"`)
+
+	_, err = source.duration("NEGATIVE", time.Second)
+	assert.EqualError(t, err, "wrong NEGATIVE: negative duration")
+
+	duration, err = source.timeout("SECONDS", time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second*90, duration)
+
+	duration, err = source.timeout("DURATION", time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second*90, duration)
+
+	duration, err = source.timeout("EMPTY", time.Second*10)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second*10, duration)
+
+	_, err = source.timeout("ZERO", time.Second)
+	assert.EqualError(t, err, `wrong ZERO: should be positive, expected duration like "10s" or number of seconds`)
+
+	_, err = source.timeout("WRONG_BOOL", time.Second)
+	assert.EqualError(
+		t, err, `wrong WRONG_BOOL: time: invalid duration "yes please", expected duration like "10s" or number of seconds`,
+	)
+}
+
+func TestConfigProblems(t *testing.T) {
+	var problems ConfigProblems
+	assert.NoError(t, problems.err())
+
+	problems.add(nil)
+	problems.add(errors.New("first problem"))
+	assert.EqualError(t, problems.err(), "first problem")
+
+	problems.add(errors.Join(errors.New("second problem"), ConfigError{problems: []error{errors.New("third problem")}}))
+
+	err := problems.err()
+	assert.EqualError(t, err, "3 problems:\n  - first problem\n  - second problem\n  - third problem")
+	assert.IsType(t, ConfigError{}, err)
+	assert.Len(t, err.(ConfigError).Unwrap(), 3)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DbConnection describes secondary Dekanat DB by separate settings, it is alternative to SECONDARY_DEKANAT_DB_DSN
+// which keeps password out of env variables with SECONDARY_DEKANAT_DB_PASSWORD_FILE.
+type DbConnection struct {
+	host     string
+	port     string
+	database string
+	user     string
+	password string
+	charset  string
+	role     string
+}
+
+func loadDbConnection(source *ConfigSource) (DbConnection, error) {
+	var problems ConfigProblems
+	var err error
+
+	connection := DbConnection{
+		host:     source.get("SECONDARY_DEKANAT_DB_HOST"),
+		port:     source.get("SECONDARY_DEKANAT_DB_PORT"),
+		database: source.get("SECONDARY_DEKANAT_DB_DATABASE"),
+		charset:  source.get("SECONDARY_DEKANAT_DB_CHARSET"),
+		role:     source.get("SECONDARY_DEKANAT_DB_ROLE"),
+	}
+
+	connection.user, err = source.secret("SECONDARY_DEKANAT_DB_USER")
+	problems.add(err)
+
+	connection.password, err = source.secret("SECONDARY_DEKANAT_DB_PASSWORD")
+	problems.add(err)
+
+	return connection, problems.err()
+}
+
+func (connection DbConnection) isEmpty() bool {
+	return connection == DbConnection{}
+}
+
+// dsn assembles connection string in format of driver, credentials are escaped.
+func (connection DbConnection) dsn(driverName string) (string, error) {
+	var problems ConfigProblems
+	unsupported := func(name string, value string) {
+		if value != "" {
+			problems.add(fmt.Errorf("SECONDARY_DEKANAT_DB_%s is not supported by %s driver", name, driverName))
+		}
+	}
+
+	if connection.database == "" {
+		problems.add(errors.New("empty SECONDARY_DEKANAT_DB_DATABASE: required to assemble DSN"))
+	}
+
+	// sqlite database is local file
+	if driverName == "sqlite" || driverName == "sqlite3" {
+		unsupported("HOST", connection.host)
+		unsupported("PORT", connection.port)
+		unsupported("USER", connection.user)
+		unsupported("PASSWORD", connection.password)
+		unsupported("CHARSET", connection.charset)
+		unsupported("ROLE", connection.role)
+
+		return connection.database, problems.err()
+	}
+
+	if connection.host == "" {
+		problems.add(errors.New("empty SECONDARY_DEKANAT_DB_HOST: required to assemble DSN"))
+	}
+
+	address := connection.host
+	if connection.port != "" {
+		address = net.JoinHostPort(connection.host, connection.port)
+	}
+
+	var dsn string
+	switch driverName {
+	case "firebirdsql":
+		dsn = connection.url("", address, url.Values{"charset": {connection.charset}, "role": {connection.role}})
+
+	case "postgres", "pgx":
+		unsupported("ROLE", connection.role)
+		dsn = connection.url("postgres", address, url.Values{"client_encoding": {connection.charset}})
+
+	case "mysql":
+		unsupported("ROLE", connection.role)
+		config := mysql.NewConfig()
+		config.User, config.Passwd = connection.user, connection.password
+		config.Net, config.Addr = "tcp", address
+		config.DBName = connection.database
+		// bound datetime of import window is local time
+		config.Loc = time.Local
+		if connection.charset != "" {
+			config.Params = map[string]string{"charset": connection.charset}
+		}
+		dsn = config.FormatDSN()
+
+	default:
+		problems.add(fmt.Errorf(
+			"DSN can not be assembled for %s driver, set SECONDARY_DEKANAT_DB_DSN instead", driverName,
+		))
+	}
+
+	if err := problems.err(); err != nil {
+		return "", err
+	}
+
+	return dsn, nil
+}
+
+// url builds user:password@host:port/database?options, scheme is omitted when it is empty.
+func (connection DbConnection) url(scheme string, address string, options url.Values) string {
+	for name, values := range options {
+		if values[0] == "" {
+			delete(options, name)
+		}
+	}
+
+	dsnUrl := url.URL{Scheme: scheme, Host: address, Path: connection.database, RawQuery: options.Encode()}
+	if !strings.HasPrefix(dsnUrl.Path, "/") {
+		dsnUrl.Path = "/" + dsnUrl.Path
+	}
+	if connection.password != "" {
+		dsnUrl.User = url.UserPassword(connection.user, connection.password)
+	} else if connection.user != "" {
+		dsnUrl.User = url.User(connection.user)
+	}
+
+	return strings.TrimPrefix(dsnUrl.String(), "//")
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestDbConnectionDsn(t *testing.T) {
+	connection := DbConnection{
+		host:     "db",
+		port:     "5432",
+		database: "dekanat",
+		user:     "importer",
+		password: "p@ss/word",
+		charset:  "UTF8",
+	}
+
+	t.Run("firebirdsql", func(t *testing.T) {
+		dsn, err := DbConnection{host: "db", database: "DEKANAT", user: "SYSDBA", role: "READER"}.dsn("firebirdsql")
+		assert.NoError(t, err)
+		assert.Equal(t, "SYSDBA@db/DEKANAT?role=READER", dsn)
+
+		dsn, err = DbConnection{host: "db", database: "C:/db/DEKANAT.FDB", user: "SYSDBA", password: "pass"}.dsn("firebirdsql")
+		assert.NoError(t, err)
+		assert.Equal(t, "SYSDBA:pass@db/C:/db/DEKANAT.FDB", dsn)
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		dsn, err := connection.dsn("postgres")
+		assert.NoError(t, err)
+		assert.Equal(t, "postgres://importer:p%40ss%2Fword@db:5432/dekanat?client_encoding=UTF8", dsn)
+
+		withRole := connection
+		withRole.role = "reader"
+		_, err = withRole.dsn("pgx")
+		assert.EqualError(t, err, "SECONDARY_DEKANAT_DB_ROLE is not supported by pgx driver")
+	})
+
+	t.Run("mysql", func(t *testing.T) {
+		dsn, err := connection.dsn("mysql")
+		assert.NoError(t, err)
+
+		parsed, err := mysql.ParseDSN(dsn)
+		assert.NoError(t, err)
+		assert.Equal(t, "importer", parsed.User)
+		assert.Equal(t, "p@ss/word", parsed.Passwd)
+		assert.Equal(t, "db:5432", parsed.Addr)
+		assert.Equal(t, "dekanat", parsed.DBName)
+		assert.Equal(t, map[string]string{"charset": "UTF8"}, parsed.Params)
+		assert.Equal(t, time.Local, parsed.Loc)
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		dsn, err := DbConnection{database: "/var/lib/dekanat.sqlite"}.dsn("sqlite")
+		assert.NoError(t, err)
+		assert.Equal(t, "/var/lib/dekanat.sqlite", dsn)
+
+		_, err = DbConnection{database: "dekanat.sqlite", host: "db", user: "importer"}.dsn("sqlite3")
+		assert.EqualError(
+			t, err, "2 problems:"+
+				"\n  - SECONDARY_DEKANAT_DB_HOST is not supported by sqlite3 driver"+
+				"\n  - SECONDARY_DEKANAT_DB_USER is not supported by sqlite3 driver",
+		)
+	})
+
+	t.Run("missing settings", func(t *testing.T) {
+		_, err := DbConnection{user: "importer"}.dsn("firebirdsql")
+		assert.EqualError(
+			t, err, "2 problems:"+
+				"\n  - empty SECONDARY_DEKANAT_DB_DATABASE: required to assemble DSN"+
+				"\n  - empty SECONDARY_DEKANAT_DB_HOST: required to assemble DSN",
+		)
+
+		_, err = connection.dsn("oracle")
+		assert.EqualError(t, err, "DSN can not be assembled for oracle driver, set SECONDARY_DEKANAT_DB_DSN instead")
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+)
+
+const DisciplineDeadLetterEventName = "DisciplineDeadLetter"
+
+// DisciplineDeadLetter describes row of Dekanat DB which can not be published as DisciplineEvent.
+type DisciplineDeadLetter struct {
+	Year  int
+	Error string
+	// Row holds raw values of result columns
+	Row map[string]any
+}
+
+var errEmptyDisciplineName = errors.New("empty discipline name")
+
+// quarantine publishes invalid row to dead letter writer. It returns rowErr when dead letter writer
+// is not configured, or an error when invalid rows budget is exceeded.
+func (importer Importer) quarantine(ctx context.Context, run *ImportRun, columns []string, rows *sql.Rows, rowErr error, invalidRows int) error {
+	if importer.deadLetter == nil {
+		return rowErr
+	}
+
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	_ = rows.Scan(pointers...)
+
+	deadLetter := DisciplineDeadLetter{
+		Year:  run.Task.Year,
+		Error: rowErr.Error(),
+		Row:   make(map[string]any, len(columns)),
+	}
+	for i, column := range columns {
+		if value, isBytes := values[i].([]byte); isBytes {
+			values[i] = string(value)
+		}
+		deadLetter.Row[column] = values[i]
+	}
+
+	payload, _ := json.Marshal(deadLetter)
+	err := importer.deadLetter.WriteMessages(ctx, kafka.Message{
+		Key:     []byte(DisciplineDeadLetterEventName),
+		Value:   payload,
+		Headers: run.headers(DisciplineDeadLetterEventName, DefaultSchemaVersion),
+	})
+	if err != nil {
+		return err
+	}
+
+	if invalidRows > importer.maxInvalidRows {
+		return fmt.Errorf("invalid rows budget exceeded: %d invalid rows, allowed %d", invalidRows, importer.maxInvalidRows)
+	}
+
+	return nil
+}
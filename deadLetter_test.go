@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kneu-messenger-pigeon/events/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+)
+
+func TestImporterQuarantine(t *testing.T) {
+	rowErr := errors.New("row error")
+
+	db, dbMock, _ := sqlmock.New()
+	dbMock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows(expectedColumns).AddRow([]byte("10"), nil))
+
+	rows, _ := db.Query("SELECT")
+	defer rows.Close()
+	rows.Next()
+
+	t.Run("without dead letter", func(t *testing.T) {
+		importer := Importer{}
+		assert.Equal(t, rowErr, importer.quarantine(context.Background(), &ImportRun{Task: ImportTask{Year: 2030}}, expectedColumns, rows, rowErr, 1))
+	})
+
+	t.Run("dead letter writer error", func(t *testing.T) {
+		expectedError := errors.New("expected test error")
+		deadLetter := mocks.NewWriterInterface(t)
+		deadLetter.On("WriteMessages", mock.MatchedBy(func(ctx context.Context) bool { return true }), mock.Anything).
+			Return(expectedError)
+
+		importer := Importer{deadLetter: deadLetter, maxInvalidRows: 10}
+		assert.Equal(t, expectedError, importer.quarantine(context.Background(), &ImportRun{Task: ImportTask{Year: 2030}}, expectedColumns, rows, rowErr, 1))
+	})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SqlDialect describes differences of SQL databases used as secondary Dekanat DB or its mirror.
+// Zero value is the Firebird dialect.
+type SqlDialect struct {
+	Name string
+	// numberedPlaceholders rewrites ? placeholders into $1, $2, ...
+	numberedPlaceholders bool
+	// nativeDatetime binds time.Time as is instead of dateFormat string
+	nativeDatetime bool
+	// identifierQuote is empty when identifiers are not quoted, e.g. by DEKANAT_DB_QUOTE_IDENTIFIERS=false
+	identifierQuote string
+}
+
+var FirebirdDialect = SqlDialect{Name: "firebird"}
+var PostgresDialect = SqlDialect{Name: "postgres", numberedPlaceholders: true, nativeDatetime: true, identifierQuote: `"`}
+var MysqlDialect = SqlDialect{Name: "mysql", nativeDatetime: true, identifierQuote: "`"}
+var SqliteDialect = SqlDialect{Name: "sqlite", identifierQuote: `"`}
+
+var sqlDialects = map[string]SqlDialect{
+	FirebirdDialect.Name: FirebirdDialect,
+	PostgresDialect.Name: PostgresDialect,
+	MysqlDialect.Name:    MysqlDialect,
+	SqliteDialect.Name:   SqliteDialect,
+}
+
+var driverDialects = map[string]SqlDialect{
+	"postgres": PostgresDialect,
+	"pgx":      PostgresDialect,
+	"mysql":    MysqlDialect,
+	"sqlite":   SqliteDialect,
+	"sqlite3":  SqliteDialect,
+}
+
+// resolveSqlDialect returns dialect by name, or guesses it by driver name when name is empty.
+// Unknown drivers fall back to Firebird, the secondary Dekanat DB itself.
+func resolveSqlDialect(name string, driverName string) (SqlDialect, error) {
+	if name == "" {
+		if dialect, exists := driverDialects[driverName]; exists {
+			return dialect, nil
+		}
+		return FirebirdDialect, nil
+	}
+
+	if dialect, exists := sqlDialects[name]; exists {
+		return dialect, nil
+	}
+
+	return SqlDialect{}, errors.New("unknown SQL dialect " + strconv.Quote(name))
+}
+
+// rebind rewrites ? placeholders outside of string literals and quoted identifiers for the dialect.
+func (dialect SqlDialect) rebind(query string) string {
+	if !dialect.numberedPlaceholders {
+		return query
+	}
+
+	var result strings.Builder
+	var quote rune
+	n := 0
+	for _, char := range query {
+		switch {
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			}
+		case char == '\'' || char == '"' || char == '`':
+			quote = char
+		case char == '?':
+			n++
+			result.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		result.WriteRune(char)
+	}
+
+	return result.String()
+}
+
+// bindDatetime binds time.Time where driver keeps wall clock time of it: Postgres ignores zone of timestamp without
+// time zone and mysql driver converts time into loc of DSN, which should be Local. SQLite has no datetime type and
+// Firebird driver expects local time, so they are given dateFormat string.
+func (dialect SqlDialect) bindDatetime(datetime time.Time) any {
+	if dialect.nativeDatetime {
+		return datetime
+	}
+
+	return datetime.Format(dateFormat)
+}
+
+// withoutQuotes keeps identifiers as is, so Postgres folds names of enrichment joins to lower case.
+func (dialect SqlDialect) withoutQuotes() SqlDialect {
+	dialect.identifierQuote = ""
+	return dialect
+}
+
+// quoteIdentifier quotes each part of dotted identifier, e.g. T_PD_CMS.ID.
+func (dialect SqlDialect) quoteIdentifier(identifier string) string {
+	if dialect.identifierQuote == "" {
+		return identifier
+	}
+
+	parts := strings.Split(identifier, ".")
+	for i, part := range parts {
+		parts[i] = dialect.identifierQuote +
+			strings.ReplaceAll(part, dialect.identifierQuote, dialect.identifierQuote+dialect.identifierQuote) +
+			dialect.identifierQuote
+	}
+
+	return strings.Join(parts, ".")
+}
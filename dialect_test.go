@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestResolveSqlDialect(t *testing.T) {
+	t.Run("by name", func(t *testing.T) {
+		for name, expected := range sqlDialects {
+			dialect, err := resolveSqlDialect(name, "firebirdsql")
+			assert.NoError(t, err)
+			assert.Equal(t, expected, dialect)
+		}
+	})
+
+	t.Run("by driver name", func(t *testing.T) {
+		testCases := map[string]SqlDialect{
+			"firebirdsql":   FirebirdDialect,
+			"firebird-test": FirebirdDialect,
+			"postgres":      PostgresDialect,
+			"pgx":           PostgresDialect,
+			"mysql":         MysqlDialect,
+			"sqlite":        SqliteDialect,
+		}
+
+		for driverName, expected := range testCases {
+			dialect, err := resolveSqlDialect("", driverName)
+			assert.NoError(t, err)
+			assert.Equalf(t, expected, dialect, "Expected %s dialect for %s driver", expected.Name, driverName)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		_, err := resolveSqlDialect("oracle", "firebirdsql")
+		assert.EqualError(t, err, `unknown SQL dialect "oracle"`)
+	})
+}
+
+func TestSqlDialectRebind(t *testing.T) {
+	query := "SELECT ID FROM T WHERE NAME <> '?' AND \"?\" = ? AND REGDATE BETWEEN ? AND ?"
+
+	assert.Equal(t, query, FirebirdDialect.rebind(query))
+	assert.Equal(t, query, MysqlDialect.rebind(query))
+	assert.Equal(t, query, SqliteDialect.rebind(query))
+	assert.Equal(
+		t,
+		"SELECT ID FROM T WHERE NAME <> '?' AND \"?\" = $1 AND REGDATE BETWEEN $2 AND $3",
+		PostgresDialect.rebind(query),
+	)
+}
+
+func TestSqlDialectBindDatetime(t *testing.T) {
+	kyiv := time.FixedZone("EET", 2*60*60)
+	datetime := time.Date(2023, 3, 5, 4, 0, 0, 0, kyiv)
+
+	for _, dialect := range []SqlDialect{FirebirdDialect, SqliteDialect} {
+		assert.Equal(t, "2023-03-05 04:00:00", dialect.bindDatetime(datetime), dialect.Name)
+	}
+	for _, dialect := range []SqlDialect{PostgresDialect, MysqlDialect} {
+		assert.Equal(t, datetime, dialect.bindDatetime(datetime), dialect.Name)
+	}
+}
+
+func TestSqlDialectQuoteIdentifier(t *testing.T) {
+	assert.Equal(t, "T_PD_CMS.ID", FirebirdDialect.quoteIdentifier("T_PD_CMS.ID"))
+	assert.Equal(t, `"T_PD_CMS"."ID"`, PostgresDialect.quoteIdentifier("T_PD_CMS.ID"))
+	assert.Equal(t, `"T_PD_CMS"."ID"`, SqliteDialect.quoteIdentifier("T_PD_CMS.ID"))
+	assert.Equal(t, "`T_PD_CMS`.`ID`", MysqlDialect.quoteIdentifier("T_PD_CMS.ID"))
+	assert.Equal(t, "`A``B`", MysqlDialect.quoteIdentifier("A`B"))
+	assert.Equal(t, "T_PD_CMS.ID", PostgresDialect.withoutQuotes().quoteIdentifier("T_PD_CMS.ID"))
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/kneu-messenger-pigeon/events"
+	"github.com/segmentio/kafka-go"
+)
+
+const DisciplineRemovedEventName = "DisciplineRemovedEvent"
+
+// buildDisciplineRemovedMessage returns a tombstone for the compacted topic in DisciplineKeyMode,
+// and a DisciplineRemovedEvent with discipline id and year for legacy consumers otherwise.
+func buildDisciplineRemovedMessage(mode KeyMode, year int, id uint) kafka.Message {
+	message := kafka.Message{
+		Key: buildDisciplineMessageKey(mode, DisciplineRemovedEventName, year, id),
+		Headers: []kafka.Header{
+			{Key: EventNameHeader, Value: []byte(DisciplineRemovedEventName)},
+		},
+	}
+
+	if mode != DisciplineKeyMode {
+		event := events.DisciplineEvent{Year: year}
+		event.Id = id
+		message.Value, _ = json.Marshal(event)
+	}
+
+	return message
+}
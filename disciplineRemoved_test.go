@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/kneu-messenger-pigeon/events"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBuildDisciplineRemovedMessage(t *testing.T) {
+	t.Run("legacy", func(t *testing.T) {
+		message := buildDisciplineRemovedMessage(LegacyKeyMode, 2030, 125)
+
+		var event events.DisciplineEvent
+		err := json.Unmarshal(message.Value, &event)
+
+		assert.NoError(t, err)
+		assert.Equal(t, DisciplineRemovedEventName, string(message.Key))
+		assert.Equal(t, uint(125), event.Id)
+		assert.Equal(t, 2030, event.Year)
+		assert.Empty(t, event.Name)
+		assert.Equal(t, DisciplineRemovedEventName, string(message.Headers[0].Value))
+	})
+
+	t.Run("tombstone", func(t *testing.T) {
+		message := buildDisciplineRemovedMessage(DisciplineKeyMode, 2030, 125)
+
+		assert.Equal(t, "2030-125", string(message.Key))
+		assert.Nil(t, message.Value)
+		assert.Equal(t, EventNameHeader, message.Headers[0].Key)
+		assert.Equal(t, DisciplineRemovedEventName, string(message.Headers[0].Value))
+	})
+}
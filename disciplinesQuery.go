@@ -0,0 +1,169 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+const (
+	IdField         = "id"
+	NameField       = "name"
+	LecturerField   = "lecturer"
+	DepartmentField = "department"
+	SemesterField   = "semester"
+	StudyFormField  = "studyForm"
+)
+
+const (
+	StartDatetimeParam = "start"
+	EndDatetimeParam   = "end"
+	YearParam          = "year"
+	// AfterIdParam is id of the last written discipline when import is resumed, otherwise 0
+	AfterIdParam = "afterId"
+)
+
+// extendedFields are published only with DisciplinePayloadVersion2.
+var extendedFields = []string{LecturerField, DepartmentField, SemesterField, StudyFormField}
+
+// DisciplinesQuery describes how disciplines are selected from Dekanat DB:
+// Params lists values bound to query placeholders in order, Columns maps result columns to event fields.
+// Query with AfterIdParam must order rows by id to be resumable.
+type DisciplinesQuery struct {
+	Query   string            `yaml:"query"`
+	Params  []string          `yaml:"params"`
+	Columns map[string]string `yaml:"columns"`
+}
+
+func loadDisciplinesQuery(filename string) (query DisciplinesQuery, err error) {
+	content, err := os.ReadFile(filename)
+	if err == nil {
+		err = yaml.Unmarshal(content, &query)
+	}
+
+	return
+}
+
+func (query DisciplinesQuery) validate(payloadVersion int) error {
+	if strings.TrimSpace(query.Query) == "" {
+		return errors.New("empty query")
+	}
+
+	for _, param := range query.Params {
+		if param != StartDatetimeParam && param != EndDatetimeParam && param != YearParam && param != AfterIdParam {
+			return fmt.Errorf("unknown param %q, expected one of: start, end, year, afterId", param)
+		}
+	}
+
+	mapped := map[string]bool{}
+	for _, column := range slices.Sorted(maps.Keys(query.Columns)) {
+		field := query.Columns[column]
+		if field != IdField && field != NameField && !slices.Contains(extendedFields, field) {
+			return fmt.Errorf("column %s is mapped to unknown field %q", column, field)
+		}
+		if mapped[field] {
+			return fmt.Errorf("field %s is mapped to several columns", field)
+		}
+		if payloadVersion != DisciplinePayloadVersion2 && slices.Contains(extendedFields, field) {
+			return fmt.Errorf("field %s requires payload version 2", field)
+		}
+		mapped[field] = true
+	}
+
+	for _, field := range []string{IdField, NameField} {
+		if !mapped[field] {
+			return fmt.Errorf("field %s is not mapped to any column", field)
+		}
+	}
+
+	return nil
+}
+
+// validateColumns checks that every mapped column is present in the query result.
+func (query DisciplinesQuery) validateColumns(resultColumns []string) error {
+	for _, column := range slices.Sorted(maps.Keys(query.Columns)) {
+		if !slices.ContainsFunc(resultColumns, func(resultColumn string) bool {
+			return strings.EqualFold(column, resultColumn)
+		}) {
+			return fmt.Errorf("column %s is absent in query result columns %v", column, resultColumns)
+		}
+	}
+
+	return nil
+}
+
+// check runs the query for an empty window to validate its result columns.
+func (query DisciplinesQuery) check(db *sql.DB, dialect SqlDialect) error {
+	rows, err := db.Query(dialect.rebind(query.Query), query.args(ImportTask{}, 0, dialect)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err == nil {
+		err = query.validateColumns(columns)
+	}
+
+	return err
+}
+
+func (query DisciplinesQuery) isResumable() bool {
+	return slices.Contains(query.Params, AfterIdParam)
+}
+
+func (query DisciplinesQuery) args(task ImportTask, afterId uint, dialect SqlDialect) []any {
+	args := make([]any, len(query.Params))
+	for i, param := range query.Params {
+		switch param {
+		case StartDatetimeParam:
+			args[i] = dialect.bindDatetime(task.StartDatetime)
+		case EndDatetimeParam:
+			args[i] = dialect.bindDatetime(task.EndDatetime)
+		case YearParam:
+			args[i] = task.Year
+		case AfterIdParam:
+			args[i] = int64(afterId)
+		}
+	}
+
+	return args
+}
+
+// scanTargets returns destinations for rows.Scan in the order of result columns
+// and function to copy scanned extended fields into event.
+func (query DisciplinesQuery) scanTargets(resultColumns []string, event *DisciplineEventV2) ([]any, func()) {
+	var lecturer, department, studyForm sql.NullString
+	var semester sql.NullInt64
+
+	fieldTargets := map[string]any{
+		IdField:         &event.Id,
+		NameField:       &event.Name,
+		LecturerField:   &lecturer,
+		DepartmentField: &department,
+		SemesterField:   &semester,
+		StudyFormField:  &studyForm,
+	}
+
+	targets := make([]any, len(resultColumns))
+	for i, resultColumn := range resultColumns {
+		targets[i] = new(any)
+		for column, field := range query.Columns {
+			if strings.EqualFold(column, resultColumn) {
+				targets[i] = fieldTargets[field]
+			}
+		}
+	}
+
+	return targets, func() {
+		event.Lecturer = strings.TrimSpace(lecturer.String)
+		event.Department = strings.TrimSpace(department.String)
+		event.Semester = uint8(semester.Int64)
+		event.StudyForm = strings.TrimSpace(studyForm.String)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testQueryFileContent = `
+query: |
+  SELECT T_PD_CMS.ID, TPR_COLL.PREDMET, T_PD_CMS.SEMESTR FROM T_PD_CMS
+  INNER JOIN TPR_COLL ON T_PD_CMS.PREDM_ID = TPR_COLL.ID
+  WHERE T_PD_CMS.YEAR = ? AND T_PD_CMS.REGDATE BETWEEN ? AND ?
+params: [year, start, end]
+columns:
+  ID: id
+  PREDMET: name
+  SEMESTR: semester
+`
+
+func TestLoadDisciplinesQuery(t *testing.T) {
+	t.Run("valid file", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "query.yaml")
+		_ = os.WriteFile(filename, []byte(testQueryFileContent), 0644)
+
+		query, err := loadDisciplinesQuery(filename)
+
+		assert.NoError(t, err)
+		assert.Contains(t, query.Query, "WHERE T_PD_CMS.YEAR = ? AND T_PD_CMS.REGDATE BETWEEN ? AND ?")
+		assert.Equal(t, []string{YearParam, StartDatetimeParam, EndDatetimeParam}, query.Params)
+		assert.Equal(
+			t, map[string]string{"ID": IdField, "PREDMET": NameField, "SEMESTR": SemesterField}, query.Columns,
+		)
+	})
+
+	t.Run("broken file", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "query.yaml")
+		_ = os.WriteFile(filename, []byte("query: [broken"), 0644)
+
+		_, err := loadDisciplinesQuery(filename)
+		assert.Error(t, err)
+	})
+}
+
+func TestDisciplinesQueryValidate(t *testing.T) {
+	valid := DisciplinesQuery{
+		Query:   "SELECT ID, NAME FROM T",
+		Params:  []string{StartDatetimeParam, EndDatetimeParam, YearParam},
+		Columns: map[string]string{"ID": IdField, "NAME": NameField},
+	}
+
+	assert.NoError(t, valid.validate(DisciplinePayloadVersion1))
+
+	testCases := map[string]DisciplinesQuery{
+		"empty query": {
+			Columns: valid.Columns,
+		},
+		`unknown param "from", expected one of: start, end, year, afterId`: {
+			Query: valid.Query, Params: []string{"from"}, Columns: valid.Columns,
+		},
+		`column TEACHER is mapped to unknown field "teacher"`: {
+			Query: valid.Query, Columns: map[string]string{"ID": IdField, "NAME": NameField, "TEACHER": "teacher"},
+		},
+		"field name is mapped to several columns": {
+			Query: valid.Query, Columns: map[string]string{"ID": IdField, "NAME": NameField, "TITLE": NameField},
+		},
+		"field name is not mapped to any column": {
+			Query: valid.Query, Columns: map[string]string{"ID": IdField},
+		},
+		"field department requires payload version 2": {
+			Query: valid.Query, Columns: map[string]string{"ID": IdField, "NAME": NameField, "KAF": DepartmentField},
+		},
+	}
+
+	for expectedError, query := range testCases {
+		assert.EqualError(t, query.validate(DisciplinePayloadVersion1), expectedError)
+	}
+}
+
+func TestDisciplinesQueryValidateColumns(t *testing.T) {
+	query := DisciplinesQuery{
+		Columns: map[string]string{"ID": IdField, "PREDMET": NameField},
+	}
+
+	assert.NoError(t, query.validateColumns([]string{"id", "predmet", "extra"}))
+	assert.EqualError(
+		t, query.validateColumns([]string{"ID", "NAME"}),
+		"column PREDMET is absent in query result columns [ID NAME]",
+	)
+}
+
+func TestDisciplinesQueryCheck(t *testing.T) {
+	query := DisciplinesQuery{
+		Query:   "SELECT ID, PREDMET FROM T_PD_CMS WHERE REGDATE BETWEEN ? AND ?",
+		Params:  []string{StartDatetimeParam, EndDatetimeParam},
+		Columns: map[string]string{"ID": IdField, "PREDMET": NameField},
+	}
+	zeroDatetime := time.Time{}.Format(dateFormat)
+
+	t.Run("valid", func(t *testing.T) {
+		db, dbMock, _ := sqlmock.New()
+		dbMock.ExpectQuery("SELECT ID, PREDMET FROM T_PD_CMS").WithArgs(zeroDatetime, zeroDatetime).
+			WillReturnRows(sqlmock.NewRows([]string{"ID", "PREDMET"}))
+
+		assert.NoError(t, query.check(db, FirebirdDialect))
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+
+	t.Run("missed column", func(t *testing.T) {
+		db, dbMock, _ := sqlmock.New()
+		dbMock.ExpectQuery("SELECT ID, PREDMET FROM T_PD_CMS").
+			WillReturnRows(sqlmock.NewRows([]string{"ID", "NAME"}))
+
+		assert.EqualError(t, query.check(db, FirebirdDialect), "column PREDMET is absent in query result columns [ID NAME]")
+	})
+
+	t.Run("query error", func(t *testing.T) {
+		expectedError := errors.New("expected test error")
+		db, dbMock, _ := sqlmock.New()
+		dbMock.ExpectQuery("SELECT ID, PREDMET FROM T_PD_CMS").WillReturnError(expectedError)
+
+		assert.Equal(t, expectedError, query.check(db, FirebirdDialect))
+	})
+}
+
+func TestDisciplinesQueryScanTargets(t *testing.T) {
+	query := DisciplinesQuery{
+		Columns: map[string]string{
+			"ID": IdField, "PREDMET": NameField, "FIO": LecturerField, "SEMESTR": SemesterField, "FORM": StudyFormField,
+		},
+	}
+
+	db, dbMock, _ := sqlmock.New()
+	dbMock.ExpectQuery("SELECT").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "predmet", "fio", "semestr", "form", "unused"}).
+			AddRow(10, "name 10", " Іваненко І.І. ", 2, "денна", "x").
+			AddRow(11, "name 11", nil, nil, nil, nil),
+	)
+
+	rows, err := db.Query("SELECT")
+	assert.NoError(t, err)
+	defer rows.Close()
+
+	columns, _ := rows.Columns()
+	var event DisciplineEventV2
+	targets, fill := query.scanTargets(columns, &event)
+	assert.Len(t, targets, 6)
+
+	assert.True(t, rows.Next())
+	assert.NoError(t, rows.Scan(targets...))
+	fill()
+
+	assert.Equal(t, uint(10), event.Id)
+	assert.Equal(t, "name 10", event.Name)
+	assert.Equal(t, "Іваненко І.І.", event.Lecturer)
+	assert.Empty(t, event.Department)
+	assert.Equal(t, uint8(2), event.Semester)
+	assert.Equal(t, "денна", event.StudyForm)
+
+	assert.True(t, rows.Next())
+	assert.NoError(t, rows.Scan(targets...))
+	fill()
+
+	assert.Equal(t, uint(11), event.Id)
+	assert.Empty(t, event.Lecturer)
+	assert.Empty(t, event.Semester)
+	assert.Empty(t, event.StudyForm)
+}
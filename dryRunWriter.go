@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/kneu-messenger-pigeon/events"
+	"github.com/segmentio/kafka-go"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// DryRunWriter replaces real writers in dry-run mode: it prints messages which would be published
+// and a summary of them on Close.
+type DryRunWriter struct {
+	out io.Writer
+	// records receives messages as JSON lines; when nil, messages are pretty-printed into out
+	records *JsonlWriter
+	counts  map[string]int
+	mutex   sync.Mutex
+}
+
+func NewDryRunWriter(out io.Writer, records *JsonlWriter) *DryRunWriter {
+	return &DryRunWriter{
+		out:     out,
+		records: records,
+		counts:  map[string]int{},
+	}
+}
+
+func (writer *DryRunWriter) WriteMessages(ctx context.Context, messages ...kafka.Message) error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	for _, message := range messages {
+		writer.counts[messageEventName(message)]++
+
+		if writer.records == nil {
+			pretty, _ := json.MarshalIndent(newJsonlRecord(message), "", "  ")
+			fmt.Fprintf(writer.out, "\n%s\n", pretty)
+		}
+	}
+
+	if writer.records != nil {
+		return writer.records.WriteMessages(ctx, messages...)
+	}
+
+	return nil
+}
+
+func (writer *DryRunWriter) summary() string {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	total := 0
+	names := make([]string, 0, len(writer.counts))
+	for name, count := range writer.counts {
+		total += count
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for i, name := range names {
+		names[i] = fmt.Sprintf("%s: %d", name, writer.counts[name])
+	}
+
+	return fmt.Sprintf("Dry run: %d messages would be published (%s)", total, strings.Join(names, ", "))
+}
+
+func (writer *DryRunWriter) Close() error {
+	fmt.Fprintln(writer.out, writer.summary())
+
+	if writer.records != nil {
+		return writer.records.Close()
+	}
+
+	return nil
+}
+
+// messageEventName returns event name from EventNameHeader or from message key.
+func messageEventName(message kafka.Message) string {
+	if eventName := messageHeader(message, EventNameHeader); eventName != "" {
+		return eventName
+	}
+
+	return events.GetEventName(message.Key)
+}
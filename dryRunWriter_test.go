@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/kneu-messenger-pigeon/events"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestDryRunWriter(t *testing.T) {
+	messages := []kafka.Message{
+		{
+			Key:     []byte("2030-10"),
+			Value:   []byte(`{"Id":10,"Name":"name 10","Year":2030}`),
+			Headers: []kafka.Header{{Key: EventNameHeader, Value: []byte(events.DisciplineEventName)}},
+		},
+		{
+			Key:     []byte("2030-11"),
+			Value:   []byte(`{"Id":11,"Name":"name 11","Year":2030}`),
+			Headers: []kafka.Header{{Key: EventNameHeader, Value: []byte(events.DisciplineEventName)}},
+		},
+		{
+			Key:   []byte(DisciplineRemovedEventName),
+			Value: []byte(`{"Id":12,"Name":"","Year":2030}`),
+		},
+	}
+
+	t.Run("pretty print", func(t *testing.T) {
+		var out bytes.Buffer
+		writer := NewDryRunWriter(&out, nil)
+
+		assert.NoError(t, writer.WriteMessages(context.Background(), messages...))
+		assert.Contains(t, out.String(), "\"key\": \"2030-10\",\n")
+		assert.Contains(t, out.String(), "\"event\": \"DisciplineEvent\"")
+		assert.Contains(t, out.String(), "\"Name\": \"name 11\"")
+
+		assert.NoError(t, writer.Close())
+		assert.True(t, strings.HasSuffix(
+			out.String(),
+			"Dry run: 3 messages would be published (DisciplineEvent: 2, DisciplineRemovedEvent: 1)\n",
+		))
+	})
+
+	t.Run("json lines", func(t *testing.T) {
+		var out bytes.Buffer
+		var records bytes.Buffer
+		writer := NewDryRunWriter(&out, NewJsonlWriter(&records))
+
+		assert.NoError(t, writer.WriteMessages(context.Background(), messages...))
+		assert.NoError(t, writer.Close())
+
+		assert.Equal(t, 3, strings.Count(records.String(), "\n"))
+		assert.Equal(t, "Dry run: 3 messages would be published (DisciplineEvent: 2, DisciplineRemovedEvent: 1)\n", out.String())
+	})
+}
+
+func TestMessageEventName(t *testing.T) {
+	assert.Equal(t, "Header", messageEventName(kafka.Message{
+		Key:     []byte("Key"),
+		Headers: []kafka.Header{{Key: "other", Value: []byte("x")}, {Key: EventNameHeader, Value: []byte("Header")}},
+	}))
+	assert.Equal(t, events.DisciplineEventName, messageEventName(kafka.Message{Key: []byte(events.DisciplineEventName)}))
+}
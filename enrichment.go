@@ -0,0 +1,76 @@
+package main
+
+import (
+	"github.com/kneu-messenger-pigeon/events"
+	"strings"
+)
+
+const DisciplinePayloadVersion1 = 1
+const DisciplinePayloadVersion2 = 2
+
+// DisciplineEventV2 is a backward compatible DisciplineEvent extended with related data from Dekanat DB.
+type DisciplineEventV2 struct {
+	events.DisciplineEvent
+	Version    int
+	Lecturer   string
+	Department string
+	Semester   uint8
+	StudyForm  string
+	// RawName is the name as it is stored in Dekanat DB, before normalization
+	RawName string `json:",omitempty"`
+}
+
+// DisciplineEnrichment holds SQL expressions selected for extended fields and joins they need.
+// Expressions can refer to T_PD_CMS, TPR_COLL and any table joined in Joins.
+type DisciplineEnrichment struct {
+	Joins      string
+	Lecturer   string
+	Department string
+	Semester   string
+	StudyForm  string
+}
+
+func (enrichment DisciplineEnrichment) isEmpty() bool {
+	return enrichment == DisciplineEnrichment{}
+}
+
+// buildQuery returns the built-in disciplines query extended with enrichment columns.
+func (enrichment DisciplineEnrichment) buildQuery(dialect SqlDialect) DisciplinesQuery {
+	q := dialect.quoteIdentifier
+
+	query := DisciplinesQuery{
+		Params:  []string{StartDatetimeParam, EndDatetimeParam, AfterIdParam},
+		Columns: map[string]string{"ID": IdField, "PREDMET": NameField},
+	}
+
+	var text strings.Builder
+	text.WriteString("SELECT " + q("T_PD_CMS.ID") + ", " + q("TPR_COLL.PREDMET"))
+	for _, column := range []struct {
+		expression string
+		alias      string
+		field      string
+	}{
+		{enrichment.Lecturer, "LECTURER", LecturerField},
+		{enrichment.Department, "DEPARTMENT", DepartmentField},
+		{enrichment.Semester, "SEMESTER", SemesterField},
+		{enrichment.StudyForm, "STUDY_FORM", StudyFormField},
+	} {
+		if column.expression != "" {
+			text.WriteString(", " + column.expression + " AS " + q(column.alias))
+			query.Columns[column.alias] = column.field
+		}
+	}
+
+	text.WriteString(
+		" FROM " + q("T_PD_CMS") + " INNER JOIN " + q("TPR_COLL") +
+			" ON " + q("T_PD_CMS.PREDM_ID") + " = " + q("TPR_COLL.ID"),
+	)
+	if enrichment.Joins != "" {
+		text.WriteString(" " + enrichment.Joins)
+	}
+	text.WriteString(" WHERE " + q("T_PD_CMS.REGDATE") + " BETWEEN ? AND ? AND " + q("T_PD_CMS.ID") + " > ?")
+	text.WriteString(" ORDER BY " + q("T_PD_CMS.ID"))
+	query.Query = text.String()
+
+	return query
+}
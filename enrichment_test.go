@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDisciplineEnrichment(t *testing.T) {
+	t.Run("buildQuery without enrichment", func(t *testing.T) {
+		enrichment := DisciplineEnrichment{}
+		query := enrichment.buildQuery(FirebirdDialect)
+
+		assert.True(t, enrichment.isEmpty())
+		assert.Equal(
+			t,
+			"SELECT T_PD_CMS.ID, TPR_COLL.PREDMET FROM T_PD_CMS INNER JOIN TPR_COLL ON T_PD_CMS.PREDM_ID = TPR_COLL.ID"+
+				" WHERE T_PD_CMS.REGDATE BETWEEN ? AND ? AND T_PD_CMS.ID > ? ORDER BY T_PD_CMS.ID",
+			query.Query,
+		)
+		assert.Equal(t, []string{StartDatetimeParam, EndDatetimeParam, AfterIdParam}, query.Params)
+		assert.Equal(t, map[string]string{"ID": IdField, "PREDMET": NameField}, query.Columns)
+		assert.NoError(t, query.validate(DisciplinePayloadVersion1))
+	})
+
+	t.Run("buildQuery with enrichment", func(t *testing.T) {
+		enrichment := DisciplineEnrichment{
+			Joins:     "LEFT JOIN T_PREP ON T_PREP.ID = T_PD_CMS.PREP_ID",
+			Lecturer:  "T_PREP.FIO",
+			Semester:  "T_PD_CMS.SEMESTR",
+			StudyForm: "T_PD_CMS.FORM",
+		}
+		query := enrichment.buildQuery(FirebirdDialect)
+
+		assert.False(t, enrichment.isEmpty())
+		assert.Equal(
+			t,
+			"SELECT T_PD_CMS.ID, TPR_COLL.PREDMET, T_PREP.FIO AS LECTURER, T_PD_CMS.SEMESTR AS SEMESTER,"+
+				" T_PD_CMS.FORM AS STUDY_FORM"+
+				" FROM T_PD_CMS INNER JOIN TPR_COLL ON T_PD_CMS.PREDM_ID = TPR_COLL.ID"+
+				" LEFT JOIN T_PREP ON T_PREP.ID = T_PD_CMS.PREP_ID"+
+				" WHERE T_PD_CMS.REGDATE BETWEEN ? AND ? AND T_PD_CMS.ID > ? ORDER BY T_PD_CMS.ID",
+			query.Query,
+		)
+		assert.Equal(
+			t,
+			map[string]string{
+				"ID": IdField, "PREDMET": NameField,
+				"LECTURER": LecturerField, "SEMESTER": SemesterField, "STUDY_FORM": StudyFormField,
+			},
+			query.Columns,
+		)
+		assert.NoError(t, query.validate(DisciplinePayloadVersion2))
+		assert.EqualError(t, query.validate(DisciplinePayloadVersion1), "field lecturer requires payload version 2")
+	})
+}
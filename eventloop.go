@@ -7,7 +7,9 @@ import (
 	"github.com/kneu-messenger-pigeon/events"
 	"github.com/segmentio/kafka-go"
 	"io"
+	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -16,11 +18,48 @@ type EventLoop struct {
 	out      io.Writer
 	reader   events.ReaderInterface
 	importer ImporterInterface
+	// dryRun leaves meta events uncommitted, so they are processed again by real run
+	dryRun bool
+	// reload is called on SIGHUP at once or, during import, right after it, so settings are not changed
+	// during import; nil ignores SIGHUP
+	reload func()
 }
 
 func (eventLoop EventLoop) execute() (err error) {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	defer stop()
+
+	// importing is held during import, so reload waits for its end instead of the next meta event
+	var importing sync.Mutex
+	if eventLoop.reload != nil {
+		hangup := make(chan os.Signal, 1)
+		signal.Notify(hangup, syscall.SIGHUP)
+		defer signal.Stop(hangup)
+
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-hangup:
+					if !importing.TryLock() {
+						fmt.Fprintln(eventLoop.out, "Config will be reloaded after the current import")
+						importing.Lock()
+					}
+					eventLoop.reload()
+					importing.Unlock()
+				case <-done:
+					return
+				}
+			}
+		}()
+		// reload in progress is finished before return
+		defer wg.Wait()
+		defer close(done)
+	}
+
 	for {
 		var m kafka.Message
 		m, err = eventLoop.reader.FetchMessage(ctx)
@@ -32,12 +71,29 @@ func (eventLoop EventLoop) execute() (err error) {
 		if startDatetime.IsZero() {
 			fmt.Fprintf(eventLoop.out, "Zero start time, skip event %s\n", m.Key)
 		} else {
-			err = eventLoop.importer.execute(startDatetime, endDatetime, year)
+			importing.Lock()
+			err = eventLoop.importer.execute(ctx, ImportTask{
+				StartDatetime: startDatetime,
+				EndDatetime:   endDatetime,
+				Year:          year,
+				FullImport:    string(m.Key) == events.CurrentYearEventName,
+
+				SourceTopic:     m.Topic,
+				SourcePartition: m.Partition,
+				SourceOffset:    m.Offset,
+				Traceparent:     messageHeader(m, TraceparentHeader),
+			})
+			importing.Unlock()
 			if err != nil {
 				return err
 			}
 		}
 
+		if eventLoop.dryRun {
+			fmt.Fprintf(eventLoop.out, "Dry run: skip commit of event %s\n", m.Key)
+			continue
+		}
+
 		err = eventLoop.reader.CommitMessages(context.Background(), m)
 		if err != nil {
 			return
@@ -68,10 +124,8 @@ func (eventLoop EventLoop) getDatetimeRangeFromEvent(m kafka.Message) (time.Time
 		)
 
 		if err == nil {
-			now := time.Now()
-			return time.Date(event.Year-2, 8, 1, 0, 0, 0, 0, time.Local),
-				time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, now.Location()),
-				event.Year
+			task := yearImportTask(event.Year, time.Now())
+			return task.StartDatetime, task.EndDatetime, task.Year
 		}
 	}
 
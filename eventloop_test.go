@@ -10,6 +10,9 @@ import (
 	"github.com/segmentio/kafka-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -37,6 +40,12 @@ func TestEventLoopExecute(t *testing.T) {
 		Value: payload,
 	}
 
+	expectedTask := ImportTask{
+		StartDatetime: expectedStartDatetime,
+		EndDatetime:   expectedEndDatetime,
+		Year:          expectedYear,
+	}
+
 	t.Run("success process one valid message", func(t *testing.T) {
 		reader := mocks.NewReaderInterface(t)
 		reader.On("FetchMessage", matchContext).Return(message, nil).Once()
@@ -44,7 +53,41 @@ func TestEventLoopExecute(t *testing.T) {
 		reader.On("CommitMessages", matchContext, message).Return(nil)
 
 		importer := NewMockImporterInterface(t)
-		importer.On("execute", expectedStartDatetime, expectedEndDatetime, expectedYear).Return(nil)
+		importer.On("execute", matchContext, expectedTask).Return(nil)
+
+		eventLoop := EventLoop{
+			out:      &out,
+			reader:   reader,
+			importer: importer,
+		}
+
+		err := eventLoop.execute()
+
+		assert.Equal(t, breakLoopError, err)
+		reader.AssertExpectations(t)
+		importer.AssertExpectations(t)
+	})
+
+	t.Run("current year event is full import", func(t *testing.T) {
+		payload, _ := json.Marshal(events.CurrentYearEvent{Year: expectedYear})
+		currentYearMessage := kafka.Message{
+			Topic:  events.MetaEventsTopic,
+			Offset: 42,
+			Key:    []byte(events.CurrentYearEventName),
+			Value:  payload,
+		}
+
+		reader := mocks.NewReaderInterface(t)
+		reader.On("FetchMessage", matchContext).Return(currentYearMessage, nil).Once()
+		reader.On("FetchMessage", matchContext).Return(kafka.Message{}, breakLoopError)
+		reader.On("CommitMessages", matchContext, currentYearMessage).Return(nil)
+
+		importer := NewMockImporterInterface(t)
+		importer.On("execute", matchContext, mock.MatchedBy(func(task ImportTask) bool {
+			return task.FullImport && task.Year == expectedYear &&
+				task.SourceTopic == currentYearMessage.Topic && task.SourceOffset == currentYearMessage.Offset &&
+				task.StartDatetime.Equal(time.Date(expectedYear-2, 8, 1, 0, 0, 0, 0, time.Local))
+		})).Return(nil)
 
 		eventLoop := EventLoop{
 			out:      &out,
@@ -59,13 +102,103 @@ func TestEventLoopExecute(t *testing.T) {
 		importer.AssertExpectations(t)
 	})
 
+	t.Run("dry run does not commit", func(t *testing.T) {
+		reader := mocks.NewReaderInterface(t)
+		reader.On("FetchMessage", matchContext).Return(message, nil).Once()
+		reader.On("FetchMessage", matchContext).Return(kafka.Message{}, breakLoopError)
+
+		importer := NewMockImporterInterface(t)
+		importer.On("execute", matchContext, expectedTask).Return(nil)
+
+		eventLoop := EventLoop{
+			out:      &out,
+			reader:   reader,
+			importer: importer,
+			dryRun:   true,
+		}
+
+		err := eventLoop.execute()
+
+		assert.Equal(t, breakLoopError, err)
+		reader.AssertNotCalled(t, "CommitMessages")
+		importer.AssertExpectations(t)
+	})
+
+	t.Run("reload on SIGHUP while waiting for meta event", func(t *testing.T) {
+		reloaded := make(chan struct{})
+		reader := mocks.NewReaderInterface(t)
+		reader.On("FetchMessage", matchContext).Return(kafka.Message{}, breakLoopError).Once().Run(func(mock.Arguments) {
+			_ = syscall.Kill(os.Getpid(), syscall.SIGHUP)
+			select {
+			case <-reloaded:
+			case <-time.After(time.Second):
+				assert.Fail(t, "config is not reloaded until the next meta event")
+			}
+		})
+
+		eventLoop := EventLoop{
+			out:      &out,
+			reader:   reader,
+			importer: NewMockImporterInterface(t),
+			reload: func() {
+				close(reloaded)
+			},
+		}
+
+		err := eventLoop.execute()
+
+		assert.Equal(t, breakLoopError, err)
+	})
+
+	t.Run("reload on SIGHUP during import after it", func(t *testing.T) {
+		var calls []string
+		reloaded := make(chan struct{})
+		reader := mocks.NewReaderInterface(t)
+		reader.On("FetchMessage", matchContext).Return(message, nil).Once()
+		reader.On("FetchMessage", matchContext).Return(kafka.Message{}, breakLoopError).Run(func(mock.Arguments) {
+			select {
+			case <-reloaded:
+			case <-time.After(time.Second):
+				assert.Fail(t, "config is not reloaded after import")
+			}
+		})
+		reader.On("CommitMessages", matchContext, message).Return(nil)
+
+		importer := NewMockImporterInterface(t)
+		importer.On("execute", matchContext, expectedTask).Return(nil).Run(func(mock.Arguments) {
+			_ = syscall.Kill(os.Getpid(), syscall.SIGHUP)
+			time.Sleep(time.Millisecond * 100)
+			calls = append(calls, "execute")
+		})
+
+		// reload is logged concurrently with the event loop, so output is written into file as into stdout
+		logFile, _ := os.Create(filepath.Join(t.TempDir(), "out.log"))
+		defer logFile.Close()
+		eventLoop := EventLoop{
+			out:      logFile,
+			reader:   reader,
+			importer: importer,
+			reload: func() {
+				calls = append(calls, "reload")
+				close(reloaded)
+			},
+		}
+
+		err := eventLoop.execute()
+
+		assert.Equal(t, breakLoopError, err)
+		assert.Equal(t, []string{"execute", "reload"}, calls)
+		log, _ := os.ReadFile(logFile.Name())
+		assert.Contains(t, string(log), "Config will be reloaded after the current import")
+	})
+
 	t.Run("process one valid message with error on commit", func(t *testing.T) {
 		reader := mocks.NewReaderInterface(t)
 		reader.On("FetchMessage", matchContext).Return(message, nil).Once()
 		reader.On("CommitMessages", matchContext, message).Return(expectedError)
 
 		importer := NewMockImporterInterface(t)
-		importer.On("execute", expectedStartDatetime, expectedEndDatetime, expectedYear).Return(nil)
+		importer.On("execute", matchContext, expectedTask).Return(nil)
 
 		eventLoop := EventLoop{
 			out:      &out,
@@ -89,7 +222,7 @@ func TestEventLoopExecute(t *testing.T) {
 		reader.On("FetchMessage", matchContext).Return(message, nil).Once()
 
 		importer := NewMockImporterInterface(t)
-		importer.On("execute", expectedStartDatetime, expectedEndDatetime, expectedYear).Return(expectedError)
+		importer.On("execute", matchContext, expectedTask).Return(expectedError)
 
 		eventLoop := EventLoop{
 			out:      &out,
@@ -108,6 +241,25 @@ func TestEventLoopExecute(t *testing.T) {
 		reader.AssertNotCalled(t, "CommitMessages")
 	})
 
+	t.Run("import cancelled by shutdown", func(t *testing.T) {
+		reader := mocks.NewReaderInterface(t)
+		reader.On("FetchMessage", matchContext).Return(message, nil).Once()
+
+		importer := NewMockImporterInterface(t)
+		importer.On("execute", matchContext, expectedTask).Return(context.Canceled)
+
+		eventLoop := EventLoop{
+			out:      &out,
+			reader:   reader,
+			importer: importer,
+		}
+
+		err := eventLoop.execute()
+
+		assert.Equal(t, context.Canceled, err)
+		reader.AssertNotCalled(t, "CommitMessages")
+	})
+
 	t.Run("process one ignore message", func(t *testing.T) {
 		ignoreEvent := events.SecondaryDbScoreProcessedEvent{}
 		payload, _ = json.Marshal(ignoreEvent)
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kneu-messenger-pigeon/events"
+	"github.com/segmentio/kafka-go"
+	"io"
+	"sync"
+)
+
+const (
+	// RequiredSinkPolicy fails the write, so import is aborted
+	RequiredSinkPolicy = "required"
+	// BestEffortSinkPolicy logs and counts failed messages
+	BestEffortSinkPolicy = "best-effort"
+	// BufferedSinkPolicy keeps failed messages in memory and retries them with the next write and on Close
+	BufferedSinkPolicy = "buffered"
+)
+
+// SinkBufferLimit is max count of messages kept by buffered sink, the oldest ones are dropped.
+const SinkBufferLimit = 10000
+
+func parseSinkPolicy(value string) (string, error) {
+	switch value {
+	case "":
+		return RequiredSinkPolicy, nil
+	case RequiredSinkPolicy, BestEffortSinkPolicy, BufferedSinkPolicy:
+		return value, nil
+	}
+
+	return "", fmt.Errorf("unknown sink policy %q, expected one of: required, best-effort, buffered", value)
+}
+
+type FanoutSink struct {
+	name    string
+	policy  string
+	writer  events.WriterInterface
+	written int
+	failed  int
+	dropped int
+	buffer  []kafka.Message
+}
+
+func (sink *FanoutSink) write(ctx context.Context, messages []kafka.Message) error {
+	if len(sink.buffer) != 0 {
+		messages = append(sink.buffer[:len(sink.buffer):len(sink.buffer)], messages...)
+		sink.buffer = nil
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+
+	err := sink.writer.WriteMessages(ctx, messages...)
+	if err == nil {
+		sink.written += len(messages)
+		return nil
+	}
+
+	if sink.policy != BufferedSinkPolicy {
+		sink.failed += len(messages)
+		return err
+	}
+
+	if overflow := len(messages) - SinkBufferLimit; overflow > 0 {
+		sink.dropped += overflow
+		messages = messages[overflow:]
+	}
+	sink.buffer = messages
+
+	return err
+}
+
+func (sink *FanoutSink) summary() string {
+	return fmt.Sprintf(
+		"Sink %s (%s): written %d, failed %d, buffered %d, dropped %d",
+		sink.name, sink.policy, sink.written, sink.failed, len(sink.buffer), sink.dropped,
+	)
+}
+
+// FanoutWriter is events.WriterInterface which writes every batch to all sinks concurrently;
+// only failures of required sinks are returned, others are logged into out.
+type FanoutWriter struct {
+	out   io.Writer
+	sinks []*FanoutSink
+	mutex sync.Mutex
+}
+
+func NewFanoutWriter(out io.Writer, sinks ...*FanoutSink) *FanoutWriter {
+	return &FanoutWriter{out: out, sinks: sinks}
+}
+
+func (writer *FanoutWriter) write(ctx context.Context, messages []kafka.Message) (err error) {
+	errs := make([]error, len(writer.sinks))
+	var wg sync.WaitGroup
+	for i, sink := range writer.sinks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = sink.write(ctx, messages)
+		}()
+	}
+	wg.Wait()
+
+	for i, sink := range writer.sinks {
+		if errs[i] == nil {
+			continue
+		}
+
+		if sink.policy == RequiredSinkPolicy {
+			err = errors.Join(err, fmt.Errorf("sink %s: %w", sink.name, errs[i]))
+		} else {
+			fmt.Fprintf(writer.out, "\nSink %s (%s) failed: %v\n", sink.name, sink.policy, errs[i])
+		}
+	}
+
+	return
+}
+
+func (writer *FanoutWriter) WriteMessages(ctx context.Context, messages ...kafka.Message) error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	return writer.write(ctx, messages)
+}
+
+// Close makes the last attempt to write buffered messages, logs sinks summary and closes all of them.
+func (writer *FanoutWriter) Close() (err error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	err = writer.write(context.Background(), nil)
+	for _, sink := range writer.sinks {
+		fmt.Fprintln(writer.out, sink.summary())
+		err = errors.Join(err, sink.writer.Close())
+	}
+
+	return
+}
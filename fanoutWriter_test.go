@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/kneu-messenger-pigeon/events/mocks"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"testing"
+)
+
+func TestParseSinkPolicy(t *testing.T) {
+	policy, err := parseSinkPolicy("")
+	assert.NoError(t, err)
+	assert.Equal(t, RequiredSinkPolicy, policy)
+
+	policy, err = parseSinkPolicy("buffered")
+	assert.NoError(t, err)
+	assert.Equal(t, BufferedSinkPolicy, policy)
+
+	_, err = parseSinkPolicy("optional")
+	assert.EqualError(t, err, `unknown sink policy "optional", expected one of: required, best-effort, buffered`)
+}
+
+func TestFanoutWriter(t *testing.T) {
+	matchContext := mock.MatchedBy(func(ctx context.Context) bool { return true })
+	expectedError := errors.New("expected error")
+
+	first := kafka.Message{Key: []byte("2030-10")}
+	second := kafka.Message{Key: []byte("2030-11")}
+
+	t.Run("required sink failure", func(t *testing.T) {
+		var out bytes.Buffer
+
+		required := mocks.NewWriterInterface(t)
+		required.On("WriteMessages", matchContext, first).Return(expectedError)
+		archive := mocks.NewWriterInterface(t)
+		archive.On("WriteMessages", matchContext, first).Return(nil)
+
+		writer := NewFanoutWriter(
+			&out,
+			&FanoutSink{name: "kafka", policy: RequiredSinkPolicy, writer: required},
+			&FanoutSink{name: "file", policy: BestEffortSinkPolicy, writer: archive},
+		)
+
+		err := writer.WriteMessages(context.Background(), first)
+		assert.EqualError(t, err, "sink kafka: expected error")
+		assert.Empty(t, out.String())
+	})
+
+	t.Run("best effort sink failure", func(t *testing.T) {
+		var out bytes.Buffer
+
+		required := mocks.NewWriterInterface(t)
+		required.On("WriteMessages", matchContext, first).Return(nil)
+		required.On("WriteMessages", matchContext, second).Return(nil)
+		required.On("Close").Return(nil)
+		archive := mocks.NewWriterInterface(t)
+		archive.On("WriteMessages", matchContext, first).Return(expectedError)
+		archive.On("WriteMessages", matchContext, second).Return(nil)
+		archive.On("Close").Return(nil)
+
+		writer := NewFanoutWriter(
+			&out,
+			&FanoutSink{name: "kafka", policy: RequiredSinkPolicy, writer: required},
+			&FanoutSink{name: "file", policy: BestEffortSinkPolicy, writer: archive},
+		)
+
+		assert.NoError(t, writer.WriteMessages(context.Background(), first))
+		assert.Equal(t, "\nSink file (best-effort) failed: expected error\n", out.String())
+		assert.NoError(t, writer.WriteMessages(context.Background(), second))
+		assert.NoError(t, writer.Close())
+
+		assert.Contains(t, out.String(), "Sink kafka (required): written 2, failed 0, buffered 0, dropped 0\n")
+		assert.Contains(t, out.String(), "Sink file (best-effort): written 1, failed 1, buffered 0, dropped 0\n")
+	})
+
+	t.Run("buffered sink retries failed messages", func(t *testing.T) {
+		var out bytes.Buffer
+
+		webhook := mocks.NewWriterInterface(t)
+		webhook.On("WriteMessages", matchContext, first).Return(expectedError).Once()
+		webhook.On("WriteMessages", matchContext, first, second).Return(nil).Once()
+		webhook.On("Close").Return(nil)
+
+		writer := NewFanoutWriter(&out, &FanoutSink{name: "webhook", policy: BufferedSinkPolicy, writer: webhook})
+
+		assert.NoError(t, writer.WriteMessages(context.Background(), first))
+		assert.Len(t, writer.sinks[0].buffer, 1)
+		assert.NoError(t, writer.WriteMessages(context.Background(), second))
+		assert.Empty(t, writer.sinks[0].buffer)
+		assert.NoError(t, writer.Close())
+
+		assert.Contains(t, out.String(), "Sink webhook (buffered): written 2, failed 0, buffered 0, dropped 0\n")
+	})
+
+	t.Run("buffered sink is flushed on close", func(t *testing.T) {
+		var out bytes.Buffer
+
+		webhook := mocks.NewWriterInterface(t)
+		webhook.On("WriteMessages", matchContext, first).Return(expectedError).Twice()
+		webhook.On("Close").Return(nil)
+
+		writer := NewFanoutWriter(&out, &FanoutSink{name: "webhook", policy: BufferedSinkPolicy, writer: webhook})
+
+		assert.NoError(t, writer.WriteMessages(context.Background(), first))
+		assert.NoError(t, writer.Close())
+
+		webhook.AssertNumberOfCalls(t, "WriteMessages", 2)
+		assert.Contains(t, out.String(), "Sink webhook (buffered): written 0, failed 0, buffered 1, dropped 0\n")
+	})
+
+	t.Run("buffer limit", func(t *testing.T) {
+		messages := make([]kafka.Message, SinkBufferLimit+5)
+		webhook := &WebhookWriter{url: "http://localhost:0", batchSize: len(messages), attempts: 1, client: http.DefaultClient}
+
+		sink := &FanoutSink{name: "webhook", policy: BufferedSinkPolicy, writer: webhook}
+
+		assert.ErrorContains(t, sink.write(context.Background(), messages), "connect")
+		assert.Len(t, sink.buffer, SinkBufferLimit)
+		assert.Equal(t, 5, sink.dropped)
+	})
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// FingerprintStore keeps the hash of the last published payload of every discipline, grouped by year,
+// so unchanged disciplines are not sent again.
+type FingerprintStore struct {
+	filename     string
+	fingerprints map[int]map[uint]string
+	// readOnly store is changed only in memory, e.g. in dry-run mode
+	readOnly bool
+}
+
+func NewFingerprintStore(filename string) (*FingerprintStore, error) {
+	store := &FingerprintStore{
+		filename:     filename,
+		fingerprints: map[int]map[uint]string{},
+	}
+
+	content, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if len(content) != 0 {
+		err = json.Unmarshal(content, &store.fingerprints)
+	}
+	if err != nil {
+		return nil, errors.New("Failed to parse fingerprints file " + filename + ": " + err.Error())
+	}
+
+	return store, nil
+}
+
+func disciplineFingerprint(payload []byte) string {
+	hash := sha256.Sum256(payload)
+	return hex.EncodeToString(hash[:])
+}
+
+func (store *FingerprintStore) get(year int, id uint) (string, bool) {
+	fingerprint, exists := store.fingerprints[year][id]
+	return fingerprint, exists
+}
+
+func (store *FingerprintStore) set(year int, id uint, fingerprint string) {
+	if store.fingerprints[year] == nil {
+		store.fingerprints[year] = map[uint]string{}
+	}
+	store.fingerprints[year][id] = fingerprint
+}
+
+func (store *FingerprintStore) delete(year int, id uint) {
+	delete(store.fingerprints[year], id)
+}
+
+func (store *FingerprintStore) ids(year int) []uint {
+	ids := make([]uint, 0, len(store.fingerprints[year]))
+	for id := range store.fingerprints[year] {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	return ids
+}
+
+func (store *FingerprintStore) save() error {
+	if store.readOnly {
+		return nil
+	}
+
+	content, err := json.Marshal(store.fingerprints)
+	if err != nil {
+		return err
+	}
+
+	tmpFilename := filepath.Join(filepath.Dir(store.filename), "."+filepath.Base(store.filename)+".tmp")
+	if err = os.WriteFile(tmpFilename, content, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFilename, store.filename)
+}
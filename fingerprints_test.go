@@ -0,0 +1,89 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFingerprintStore(t *testing.T) {
+	t.Run("save and load", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "fingerprints.json")
+
+		store, err := NewFingerprintStore(filename)
+		assert.NoError(t, err)
+
+		_, exists := store.get(2030, 10)
+		assert.False(t, exists)
+
+		store.set(2030, 10, disciplineFingerprint([]byte("name 10")))
+		store.set(2031, 10, disciplineFingerprint([]byte("name 10 next year")))
+		assert.NoError(t, store.save())
+
+		store, err = NewFingerprintStore(filename)
+		assert.NoError(t, err)
+
+		fingerprint, exists := store.get(2030, 10)
+		assert.True(t, exists)
+		assert.Equal(t, disciplineFingerprint([]byte("name 10")), fingerprint)
+
+		fingerprint, exists = store.get(2031, 10)
+		assert.True(t, exists)
+		assert.Equal(t, disciplineFingerprint([]byte("name 10 next year")), fingerprint)
+	})
+
+	t.Run("ids and delete", func(t *testing.T) {
+		store, err := NewFingerprintStore(filepath.Join(t.TempDir(), "fingerprints.json"))
+		assert.NoError(t, err)
+
+		store.set(2030, 12, "a")
+		store.set(2030, 10, "b")
+		store.set(2031, 11, "c")
+
+		assert.Equal(t, []uint{10, 12}, store.ids(2030))
+		assert.Equal(t, []uint{11}, store.ids(2031))
+		assert.Empty(t, store.ids(2029))
+
+		store.delete(2030, 12)
+		store.delete(2029, 1)
+		assert.Equal(t, []uint{10}, store.ids(2030))
+	})
+
+	t.Run("read only", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "fingerprints.json")
+
+		store, err := NewFingerprintStore(filename)
+		assert.NoError(t, err)
+		store.readOnly = true
+		store.set(2030, 10, "a")
+		assert.NoError(t, store.save())
+
+		_, err = os.Stat(filename)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("empty file", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "fingerprints.json")
+		_ = os.WriteFile(filename, []byte{}, 0644)
+
+		store, err := NewFingerprintStore(filename)
+		assert.NoError(t, err)
+		assert.NotNil(t, store)
+	})
+
+	t.Run("broken file", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "fingerprints.json")
+		_ = os.WriteFile(filename, []byte("{broken"), 0644)
+
+		store, err := NewFingerprintStore(filename)
+		assert.Error(t, err)
+		assert.ErrorContains(t, err, "Failed to parse fingerprints file")
+		assert.Nil(t, store)
+	})
+
+	t.Run("fingerprint depends on name", func(t *testing.T) {
+		assert.Equal(t, disciplineFingerprint([]byte("name")), disciplineFingerprint([]byte("name")))
+		assert.NotEqual(t, disciplineFingerprint([]byte("name")), disciplineFingerprint([]byte("name 2")))
+	})
+}
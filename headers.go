@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/segmentio/kafka-go"
+	"net/url"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+const (
+	RunIdHeader           = "run-id"
+	SourceTopicHeader     = "source-topic"
+	SourcePartitionHeader = "source-partition"
+	SourceOffsetHeader    = "source-offset"
+	SourceDbHeader        = "source-db"
+	ProducerHeader        = "producer"
+	SchemaVersionHeader   = "schema-version"
+	// TraceparentHeader is W3C Trace Context header, set only when tracing is enabled
+	TraceparentHeader = "traceparent"
+)
+
+const ProducerName = "secondary-db-disciplines-importer"
+
+// DefaultSchemaVersion is schema version of events without own versioning, e.g. lifecycle and dead letter ones.
+const DefaultSchemaVersion = 1
+
+// Version is set on build with -ldflags "-X main.Version=v1.2.3", otherwise module version is used.
+var Version = ""
+
+var traceparentRegexp = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-[0-9a-f]{16}-[0-9a-f]{2}$`)
+
+func producerVersion() string {
+	if Version != "" {
+		return Version
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+
+	return "(devel)"
+}
+
+// headers returns headers of message with eventName published by the run; EventNameHeader is always the first one.
+func (run *ImportRun) headers(eventName string, schemaVersion int) []kafka.Header {
+	headers := []kafka.Header{
+		{Key: EventNameHeader, Value: []byte(eventName)},
+		{Key: RunIdHeader, Value: []byte(run.Id)},
+	}
+
+	if run.Task.SourceTopic != "" {
+		headers = append(
+			headers,
+			kafka.Header{Key: SourceTopicHeader, Value: []byte(run.Task.SourceTopic)},
+			kafka.Header{Key: SourcePartitionHeader, Value: []byte(strconv.Itoa(run.Task.SourcePartition))},
+			kafka.Header{Key: SourceOffsetHeader, Value: []byte(strconv.FormatInt(run.Task.SourceOffset, 10))},
+		)
+	}
+
+	if run.SourceDb != "" {
+		headers = append(headers, kafka.Header{Key: SourceDbHeader, Value: []byte(run.SourceDb)})
+	}
+
+	headers = append(
+		headers,
+		kafka.Header{Key: ProducerHeader, Value: []byte(ProducerName + "/" + producerVersion())},
+		kafka.Header{Key: SchemaVersionHeader, Value: []byte(strconv.Itoa(schemaVersion))},
+	)
+
+	if run.Traceparent != "" {
+		headers = append(headers, kafka.Header{Key: TraceparentHeader, Value: []byte(run.Traceparent)})
+	}
+
+	return headers
+}
+
+func messageHeader(message kafka.Message, key string) string {
+	for _, header := range message.Headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+
+	return ""
+}
+
+// newTraceparent continues trace of valid parent traceparent or starts a new one; span id identifies the run.
+func newTraceparent(parent string) string {
+	traceId := ""
+	if matches := traceparentRegexp.FindStringSubmatch(parent); matches != nil && matches[1] != strings.Repeat("0", 32) {
+		traceId = matches[1]
+	} else {
+		traceId = randomHex(16)
+	}
+
+	return "00-" + traceId + "-" + randomHex(8) + "-01"
+}
+
+func randomHex(length int) string {
+	value := make([]byte, length)
+	_, _ = rand.Read(value)
+
+	return hex.EncodeToString(value)
+}
+
+// sourceDbIdentity describes Dekanat DB by DSN without credentials and options.
+func sourceDbIdentity(driverName string, dsn string) string {
+	if parsed, err := url.Parse(dsn); err == nil && parsed.Scheme != "" && parsed.Host != "" {
+		return driverName + "://" + parsed.Host + parsed.Path
+	}
+
+	// key=value DSN, e.g. "host=localhost port=5432 dbname=dekanat user=importer password=secret"
+	if strings.Contains(dsn, "=") && !strings.Contains(dsn, "@") {
+		var parts []string
+		for _, field := range strings.Fields(dsn) {
+			key, value, _ := strings.Cut(field, "=")
+			if key == "host" || key == "port" || key == "dbname" {
+				parts = append(parts, key+"="+value)
+			}
+		}
+
+		return driverName + ":" + strings.Join(parts, " ")
+	}
+
+	if i := strings.LastIndex(dsn, "@"); i >= 0 {
+		dsn = dsn[i+1:]
+	}
+	dsn, _, _ = strings.Cut(dsn, "?")
+
+	return driverName + ":" + dsn
+}
@@ -9,71 +9,358 @@ import (
 	"github.com/segmentio/kafka-go"
 	"io"
 	"strings"
+	"sync"
 	"time"
 )
 
 const dateFormat = "2006-01-02 15:04:05"
 
+// DrainTimeout limits writing of the last batch after import is cancelled.
+const DrainTimeout = time.Second * 10
+
+// writeContext is not cancelled with ctx, so started write is completed, but once ctx is cancelled it is limited
+// by drainTimeout; otherwise RetryingWriter would retry it for WRITE_RETRY_MAX_DURATION after shutdown signal.
+func writeContext(ctx context.Context, drainTimeout time.Duration) (context.Context, context.CancelFunc) {
+	writeCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		select {
+		case <-writeCtx.Done():
+		case <-time.After(drainTimeout):
+			cancel()
+		}
+	})
+
+	return writeCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+type ImportTask struct {
+	StartDatetime time.Time
+	EndDatetime   time.Time
+	Year          int
+	// FullImport is set when the window covers the whole year, so known disciplines missing in it were removed.
+	FullImport bool
+	// Source* identify meta event which caused the import
+	SourceTopic     string
+	SourcePartition int
+	SourceOffset    int64
+	// Traceparent is W3C trace context of the source meta event
+	Traceparent string
+}
+
+// checkpointKey identifies the import, so redelivered meta event or repeated manual run has the same key.
+func (task ImportTask) checkpointKey() string {
+	if task.SourceTopic != "" {
+		return fmt.Sprintf("%s/%d/%d", task.SourceTopic, task.SourcePartition, task.SourceOffset)
+	}
+
+	return fmt.Sprintf(
+		"%s/%s/%d", task.StartDatetime.Format(time.RFC3339), task.EndDatetime.Format(time.RFC3339), task.Year,
+	)
+}
+
 type ImporterInterface interface {
-	execute(startDatetime time.Time, endDatetime time.Time, year int) error
+	execute(ctx context.Context, task ImportTask) error
 }
 
 type Importer struct {
 	out            io.Writer
 	db             *sql.DB
 	writer         events.WriterInterface
-	writeThreshold int
+	batch          BatchPolicy
+	keyMode        KeyMode
+	fingerprints   *FingerprintStore
+	force          bool
+	payloadVersion int
+	query          DisciplinesQuery
+	dialect        SqlDialect
+	normalizer     NameNormalizer
+	keepRawName    bool
+	deadLetter     events.WriterInterface
+	maxInvalidRows int
+	checkpoints    *CheckpointStore
+	// lifecycle receives DisciplinesImportStarted and DisciplinesImportFinished events, nil disables them
+	lifecycle events.WriterInterface
+	// sourceDb identifies Dekanat DB in headers of published messages
+	sourceDb string
+	// tracing adds W3C traceparent header, which continues trace of the source meta event
+	tracing bool
+	// outbox is set when writer spills undelivered batches to it, execute waits until they are delivered
+	outbox *Outbox
+	// secrets are redacted in error of DisciplinesImportFinished event and returned one, nil keeps error as is
+	secrets *strings.Replacer
+}
+
+// execute stops reading rows when ctx is cancelled, writes already read batch and returns ctx error.
+func (importer Importer) execute(ctx context.Context, task ImportTask) (err error) {
+	run := newImportRun(task, time.Now())
+	run.SourceDb = importer.sourceDb
+	if importer.tracing {
+		run.Traceparent = newTraceparent(task.Traceparent)
+	}
+	// lifecycle events are written even when import is cancelled
+	if importer.lifecycle != nil {
+		writeCtx, cancel := writeContext(ctx, DrainTimeout)
+		err = importer.lifecycle.WriteMessages(writeCtx, run.startedMessage())
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = importer.importDisciplines(ctx, task, run)
+	if err == nil && importer.outbox != nil {
+		err = importer.outbox.waitDrained(ctx, run.Id)
+	}
+	if importer.secrets != nil {
+		err = redactError(err, importer.secrets)
+	}
+
+	if importer.lifecycle != nil {
+		writeCtx, cancel := writeContext(ctx, DrainTimeout)
+		defer cancel()
+		nextErr := importer.lifecycle.WriteMessages(writeCtx, run.finishedMessage(err, time.Now()))
+		if err == nil {
+			err = nextErr
+		}
+	}
+
+	return
 }
 
-func (importer Importer) execute(startDatetime time.Time, endDatetime time.Time, year int) (err error) {
-	if err = importer.db.Ping(); err != nil {
+func (importer Importer) importDisciplines(ctx context.Context, task ImportTask, run *ImportRun) (err error) {
+	if err = importer.db.PingContext(ctx); err != nil {
 		return
 	}
 
-	rows, err := importer.db.Query(
-		`SELECT T_PD_CMS.ID, TPR_COLL.PREDMET FROM T_PD_CMS 
-        INNER JOIN TPR_COLL ON T_PD_CMS.PREDM_ID = TPR_COLL.ID 
-		WHERE T_PD_CMS.REGDATE BETWEEN ? AND ?`,
-		startDatetime.Format(dateFormat),
-		endDatetime.Format(dateFormat),
+	query := importer.query
+	if query.Query == "" {
+		query = DisciplineEnrichment{}.buildQuery(importer.dialect)
+	}
+
+	var afterId uint
+	resumed := false
+	if importer.checkpoints != nil && query.isResumable() {
+		afterId, resumed = importer.checkpoints.get(task.checkpointKey())
+	}
+	if resumed {
+		fmt.Fprintf(importer.out, "Resume import after discipline %d \n", afterId)
+	}
+
+	rows, err := importer.db.QueryContext(
+		ctx, importer.dialect.rebind(query.Query), query.args(task, afterId, importer.dialect)...,
 	)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
 
-	var messages []kafka.Message
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	// written batches are not interrupted by cancellation, so the import stops between batches
+	writeCtx, cancelWrite := writeContext(ctx, DrainTimeout)
+	defer cancelWrite()
+	batch := Batch{policy: importer.batch}
+	// fingerprints of disciplines in batch, stored only after batch is written; empty one removes discipline
+	pendingFingerprints := map[uint]string{}
+	// id of the last read discipline; all disciplines up to it are handled once batch is written
+	var lastReadId uint
+	// disciplines and removals are counted as sent only when their batch is written
+	sent, removed, pendingSent, pendingRemoved := 0, 0, 0, 0
 	var nextErr error
-	writeMessages := func(threshold int) bool {
-		if len(messages) != 0 && len(messages) >= threshold {
-			nextErr = importer.writer.WriteMessages(context.Background(), messages...)
-			messages = []kafka.Message{}
+	// writeMessages flushes batch for the reason or, when reason is empty, if batch policy requires it
+	writeMessages := func(reason string) bool {
+		if reason == "" {
+			reason = batch.flushReason(time.Now())
+		}
+		if reason != "" && batch.len() != 0 {
+			nextErr = importer.writer.WriteMessages(writeCtx, batch.take(reason)...)
 			fmt.Fprintf(importer.out, ".")
 			if err == nil && nextErr != nil {
 				err = nextErr
 			}
+			if nextErr == nil && importer.fingerprints != nil {
+				for id, fingerprint := range pendingFingerprints {
+					if fingerprint == "" {
+						importer.fingerprints.delete(task.Year, id)
+					} else {
+						importer.fingerprints.set(task.Year, id, fingerprint)
+					}
+				}
+			}
+			pendingFingerprints = map[uint]string{}
+			if nextErr == nil {
+				sent, removed = sent+pendingSent, removed+pendingRemoved
+			}
+			pendingSent, pendingRemoved = 0, 0
+			if nextErr == nil && importer.checkpoints != nil && lastReadId != 0 {
+				nextErr = importer.checkpoints.set(task.checkpointKey(), lastReadId)
+				if err == nil && nextErr != nil {
+					err = nextErr
+				}
+			}
 		}
 		return err == nil
 	}
 
-	var event events.DisciplineEvent
-	i := 0
+	// rows may come slower than linger, so the timer flushes batch while the loop waits for the next row;
+	// state of the loop is guarded by mutex, which is released only while rows.Next() waits
+	var mutex sync.Mutex
+	mutex.Lock()
+	var lingerTimer *time.Timer
+	lingerStopped := false
+	if importer.batch.linger != 0 {
+		lingerTimer = time.AfterFunc(importer.batch.linger, func() {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if lingerStopped || batch.len() == 0 {
+				return
+			}
+			// batch was flushed and started again after the timer fired
+			if elapsed := time.Since(batch.startedAt); elapsed < importer.batch.linger {
+				lingerTimer.Reset(importer.batch.linger - elapsed)
+				return
+			}
+			writeMessages(FlushByLinger)
+		})
+		lingerTimer.Stop()
+	}
+	nextRow := func() bool {
+		mutex.Unlock()
+		defer mutex.Lock()
+		return rows.Next()
+	}
+
+	var event DisciplineEventV2
+	var payload []byte
+	var fingerprint string
+	scanTargets, fillExtendedFields := query.scanTargets(columns, &event)
+	seen := map[uint]bool{}
+	skipped := 0
+	invalid := 0
 	fmt.Fprintf(importer.out, "Start import: ")
-	for rows.Next() && writeMessages(importer.writeThreshold) {
-		i++
-		err = rows.Scan(&event.Id, &event.Name)
+	for ctx.Err() == nil && nextRow() && writeMessages("") {
+		err = rows.Scan(scanTargets...)
 		if err == nil {
-			event.Name = strings.Trim(event.Name, " ")
-			event.Year = year
-			payload, _ := json.Marshal(event)
-			messages = append(messages, kafka.Message{
-				Key:   []byte(events.DisciplineEventName),
-				Value: payload,
-			})
+			fillExtendedFields()
+			if importer.keepRawName {
+				event.RawName = event.Name
+			}
+			event.Name = importer.normalizer.normalize(event.Name)
+			if event.Name == "" {
+				err = errEmptyDisciplineName
+			}
+		}
+
+		if err != nil {
+			invalid++
+			err = importer.quarantine(writeCtx, run, columns, rows, err, invalid)
+		} else {
+			event.Year = task.Year
+			seen[event.Id] = true
+
+			if importer.payloadVersion == DisciplinePayloadVersion2 {
+				event.Version = DisciplinePayloadVersion2
+				payload, _ = json.Marshal(event)
+			} else {
+				payload, _ = json.Marshal(event.DisciplineEvent)
+			}
+
+			if importer.fingerprints != nil {
+				fingerprint = disciplineFingerprint(payload)
+				if previous, exists := importer.fingerprints.get(task.Year, event.Id); exists && previous == fingerprint && !importer.force {
+					lastReadId = event.Id
+					skipped++
+					continue
+				}
+			}
+
+			message := kafka.Message{
+				Key:     buildDisciplineMessageKey(importer.keyMode, events.DisciplineEventName, task.Year, event.Id),
+				Value:   payload,
+				Headers: run.headers(events.DisciplineEventName, max(importer.payloadVersion, DisciplinePayloadVersion1)),
+			}
+			// batch is flushed before the discipline is marked as pending, so its checkpoint covers only written ones
+			if !batch.fits(message) && !writeMessages(FlushByBytes) {
+				continue
+			}
+
+			lastReadId = event.Id
+			if importer.fingerprints != nil {
+				pendingFingerprints[event.Id] = fingerprint
+			}
+			if batch.len() == 0 && lingerTimer != nil {
+				lingerTimer.Reset(importer.batch.linger)
+			}
+			pendingSent++
+			batch.add(message, time.Now())
 		}
 	}
-	writeMessages(0)
-	fmt.Fprintf(importer.out, " finished. Send %d disciplines. Error: %v \n", i, err)
+	lingerStopped = true
+	mutex.Unlock()
+	if lingerTimer != nil {
+		lingerTimer.Stop()
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	// disciplines known from previous imports, but absent in the full one, were removed from Dekanat DB;
+	// quarantined rows and rows read before resume could hide some of them, so removals are not published then
+	if err == nil && task.FullImport && importer.fingerprints != nil && invalid == 0 && !resumed {
+		for _, id := range importer.fingerprints.ids(task.Year) {
+			if seen[id] || !writeMessages("") {
+				continue
+			}
+
+			message := buildDisciplineRemovedMessage(importer.keyMode, task.Year, id)
+			message.Headers = run.headers(DisciplineRemovedEventName, DefaultSchemaVersion)
+			if !batch.fits(message) && !writeMessages(FlushByBytes) {
+				continue
+			}
+
+			pendingRemoved++
+			pendingFingerprints[id] = ""
+			batch.add(message, time.Now())
+		}
+	}
+
+	// the last batch has its own DrainTimeout, even when cancellation interrupted the previous one
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		writeCtx, cancel = writeContext(ctx, DrainTimeout)
+		defer cancel()
+	}
+	writeMessages(FlushByEnd)
+
+	if importer.fingerprints != nil {
+		if nextErr = importer.fingerprints.save(); err == nil {
+			err = nextErr
+		}
+	}
+
+	if err == nil && importer.checkpoints != nil {
+		err = importer.checkpoints.delete(task.checkpointKey())
+	}
+
+	run.Sent, run.Skipped, run.Failed, run.Removed, run.Batches = sent, skipped, invalid, removed, batch.stats
+	fmt.Fprintf(
+		importer.out, " finished. Send %d disciplines, skip %d unchanged, quarantine %d invalid, remove %d. Error: %v \n",
+		run.Sent, run.Skipped, run.Failed, run.Removed, err,
+	)
+	fmt.Fprintf(
+		importer.out, "Write %d batches, %d bytes, max batch %d bytes; flushed by count %d, bytes %d, linger %d \n",
+		batch.stats.Batches, batch.stats.Bytes, batch.stats.MaxBatchBytes,
+		batch.stats.ByCount, batch.stats.ByBytes, batch.stats.ByLinger,
+	)
 
 	return
 }
@@ -3,6 +3,8 @@ package main
 import (
 	"bytes"
 	"context"
+	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
 	"errors"
 	"github.com/DATA-DOG/go-sqlmock"
@@ -11,8 +13,11 @@ import (
 	"github.com/segmentio/kafka-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"io"
 	"log"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -44,7 +49,7 @@ func TestImporterExecute(t *testing.T) {
 		}
 
 		dbMock.ExpectQuery(expectedQuery).WithArgs(
-			startDatetime.Format(dateFormat), endDatetime.Format(dateFormat),
+			startDatetime.Format(dateFormat), endDatetime.Format(dateFormat), int64(0),
 		).WillReturnRows(rows)
 		// End Init DB Mock
 
@@ -80,22 +85,447 @@ func TestImporterExecute(t *testing.T) {
 		).Return(nil)
 		// End Init Writer Mock and Expectation
 
+		importer := Importer{
+			out:    &out,
+			db:     db,
+			writer: writer,
+			batch:  BatchPolicy{maxCount: 3},
+		}
+
+		err = importer.execute(context.Background(), ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year})
+
+		assert.NoError(t, err)
+
+		err = dbMock.ExpectationsWereMet()
+		assert.NoErrorf(t, err, "there were unfulfilled expectations: %s", err)
+		writer.AssertNumberOfCalls(t, "WriteMessages", 2)
+
+		writer.AssertExpectations(t)
+	})
+
+	t.Run("discipline key mode", func(t *testing.T) {
+		startDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
+		endDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
+
+		db, dbMock, err := sqlmock.New()
+		if err != nil {
+			log.Fatalf("an error '%s' was not expected when opening a mock database connection", err)
+		}
+
+		rows := sqlmock.NewRows(expectedColumns).AddRow(21, "name 21").AddRow(22, "name 22")
+
+		dbMock.ExpectQuery(expectedQuery).WithArgs(
+			startDatetime.Format(dateFormat), endDatetime.Format(dateFormat), int64(0),
+		).WillReturnRows(rows)
+
+		writer := mocks.NewWriterInterface(t)
+
+		messageMatcher := func(expectedKey string) func(kafka.Message) bool {
+			return func(message kafka.Message) bool {
+				return assert.Equal(t, expectedKey, string(message.Key)) &&
+					assert.Equal(t, EventNameHeader, message.Headers[0].Key) &&
+					assert.Equal(t, events.DisciplineEventName, string(message.Headers[0].Value))
+			}
+		}
+
+		writer.On(
+			"WriteMessages",
+			mock.MatchedBy(func(ctx context.Context) bool { return true }),
+			mock.MatchedBy(messageMatcher("2030-21")),
+			mock.MatchedBy(messageMatcher("2030-22")),
+		).Return(nil)
+
+		importer := Importer{
+			out:     &out,
+			db:      db,
+			writer:  writer,
+			batch:   BatchPolicy{maxCount: 3},
+			keyMode: DisciplineKeyMode,
+		}
+
+		err = importer.execute(context.Background(), ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year})
+
+		assert.NoError(t, err)
+
+		err = dbMock.ExpectationsWereMet()
+		assert.NoErrorf(t, err, "there were unfulfilled expectations: %s", err)
+		writer.AssertNumberOfCalls(t, "WriteMessages", 1)
+	})
+
+	t.Run("skip unchanged disciplines", func(t *testing.T) {
+		startDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
+		endDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
+
+		fingerprints, err := NewFingerprintStore(filepath.Join(t.TempDir(), "fingerprints.json"))
+		assert.NoError(t, err)
+		fingerprints.set(year, 10, testDisciplineFingerprint(10, "name 10", year))
+		fingerprints.set(year, 11, testDisciplineFingerprint(11, "old name 11", year))
+		fingerprints.set(year-1, 12, testDisciplineFingerprint(12, "name 12", year-1))
+
+		db, dbMock, err := sqlmock.New()
+		if err != nil {
+			log.Fatalf("an error '%s' was not expected when opening a mock database connection", err)
+		}
+
+		newRows := func() *sqlmock.Rows {
+			return sqlmock.NewRows(expectedColumns).
+				AddRow(10, "name 10").AddRow(11, "name 11").AddRow(12, "name 12")
+		}
+		dbMock.ExpectQuery(expectedQuery).WillReturnRows(newRows())
+		dbMock.ExpectQuery(expectedQuery).WillReturnRows(newRows())
+		dbMock.ExpectQuery(expectedQuery).WillReturnRows(newRows())
+
+		writer := mocks.NewWriterInterface(t)
+		idMatcher := func(expectedId uint) func(kafka.Message) bool {
+			return func(message kafka.Message) bool {
+				err = json.Unmarshal(message.Value, &event)
+				return err == nil && expectedId == event.Id
+			}
+		}
+		matchContext := mock.MatchedBy(func(ctx context.Context) bool { return true })
+
+		writer.On(
+			"WriteMessages", matchContext, mock.MatchedBy(idMatcher(11)), mock.MatchedBy(idMatcher(12)),
+		).Return(nil).Once()
+
+		importer := Importer{
+			out:          &out,
+			db:           db,
+			writer:       writer,
+			batch:        BatchPolicy{maxCount: 3},
+			fingerprints: fingerprints,
+		}
+
+		err = importer.execute(context.Background(), ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year})
+		assert.NoError(t, err)
+
+		fingerprint, _ := fingerprints.get(year, 11)
+		assert.Equal(t, testDisciplineFingerprint(11, "name 11", year), fingerprint)
+
+		// second run: everything is unchanged
+		err = importer.execute(context.Background(), ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year})
+		assert.NoError(t, err)
+		writer.AssertNumberOfCalls(t, "WriteMessages", 1)
+
+		// forced run sends everything
+		writer.On(
+			"WriteMessages", matchContext,
+			mock.MatchedBy(idMatcher(10)), mock.MatchedBy(idMatcher(11)), mock.MatchedBy(idMatcher(12)),
+		).Return(nil).Once()
+
+		importer.force = true
+		err = importer.execute(context.Background(), ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year})
+		assert.NoError(t, err)
+		writer.AssertNumberOfCalls(t, "WriteMessages", 2)
+
+		err = dbMock.ExpectationsWereMet()
+		assert.NoErrorf(t, err, "there were unfulfilled expectations: %s", err)
+
+		reloaded, err := NewFingerprintStore(fingerprints.filename)
+		assert.NoError(t, err)
+		assert.Equal(t, fingerprints.fingerprints, reloaded.fingerprints)
+	})
+
+	t.Run("fingerprints are not stored on writer error", func(t *testing.T) {
+		startDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
+		endDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
+		expectedError := errors.New("expected test error")
+
+		fingerprints, err := NewFingerprintStore(filepath.Join(t.TempDir(), "fingerprints.json"))
+		assert.NoError(t, err)
+
+		db, dbMock, err := sqlmock.New()
+		if err != nil {
+			log.Fatalf("an error '%s' was not expected when opening a mock database connection", err)
+		}
+		dbMock.ExpectQuery(expectedQuery).WillReturnRows(
+			sqlmock.NewRows(expectedColumns).AddRow(10, "name 10"),
+		)
+
+		writer := mocks.NewWriterInterface(t)
+		writer.On(
+			"WriteMessages", mock.MatchedBy(func(ctx context.Context) bool { return true }), mock.Anything,
+		).Return(expectedError)
+
+		importer := Importer{
+			out:          &out,
+			db:           db,
+			writer:       writer,
+			batch:        BatchPolicy{maxCount: 3},
+			fingerprints: fingerprints,
+		}
+
+		err = importer.execute(context.Background(), ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year})
+		assert.Equal(t, expectedError, err)
+
+		_, exists := fingerprints.get(year, 10)
+		assert.False(t, exists)
+	})
+
+	t.Run("publish removed disciplines on full import", func(t *testing.T) {
+		startDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
+		endDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
+
+		fingerprints, err := NewFingerprintStore(filepath.Join(t.TempDir(), "fingerprints.json"))
+		assert.NoError(t, err)
+		fingerprints.set(year, 10, testDisciplineFingerprint(10, "name 10", year))
+		fingerprints.set(year, 11, testDisciplineFingerprint(11, "name 11", year))
+		fingerprints.set(year, 12, testDisciplineFingerprint(12, "name 12", year))
+		fingerprints.set(year-1, 13, testDisciplineFingerprint(13, "name 13", year-1))
+
+		db, dbMock, err := sqlmock.New()
+		if err != nil {
+			log.Fatalf("an error '%s' was not expected when opening a mock database connection", err)
+		}
+		// partial import must not remove anything
+		dbMock.ExpectQuery(expectedQuery).WillReturnRows(sqlmock.NewRows(expectedColumns).AddRow(10, "name 10"))
+		dbMock.ExpectQuery(expectedQuery).WillReturnRows(sqlmock.NewRows(expectedColumns).AddRow(10, "name 10"))
+
+		writer := mocks.NewWriterInterface(t)
+		writer.On(
+			"WriteMessages",
+			mock.MatchedBy(func(ctx context.Context) bool { return true }),
+			mock.MatchedBy(func(message kafka.Message) bool {
+				return string(message.Key) == "2030-11" && message.Value == nil
+			}),
+			mock.MatchedBy(func(message kafka.Message) bool {
+				return string(message.Key) == "2030-12" && message.Value == nil
+			}),
+		).Return(nil).Once()
+
+		importer := Importer{
+			out:          &out,
+			db:           db,
+			writer:       writer,
+			batch:        BatchPolicy{maxCount: 3},
+			keyMode:      DisciplineKeyMode,
+			fingerprints: fingerprints,
+		}
+
+		task := ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year}
+		err = importer.execute(context.Background(), task)
+		assert.NoError(t, err)
+		writer.AssertNotCalled(t, "WriteMessages")
+
+		task.FullImport = true
+		err = importer.execute(context.Background(), task)
+		assert.NoError(t, err)
+		writer.AssertNumberOfCalls(t, "WriteMessages", 1)
+
+		assert.Equal(t, []uint{10}, fingerprints.ids(year))
+		assert.Equal(t, []uint{13}, fingerprints.ids(year-1))
+
+		err = dbMock.ExpectationsWereMet()
+		assert.NoErrorf(t, err, "there were unfulfilled expectations: %s", err)
+	})
+
+	t.Run("extended payload", func(t *testing.T) {
+		startDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
+		endDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
+
+		db, dbMock, err := sqlmock.New()
+		if err != nil {
+			log.Fatalf("an error '%s' was not expected when opening a mock database connection", err)
+		}
+
+		dbMock.ExpectQuery(
+			`SELECT T_PD_CMS.ID, TPR_COLL.PREDMET, T_KAF.NAME AS DEPARTMENT FROM T_PD_CMS .+ LEFT JOIN T_KAF ON`,
+		).WithArgs(
+			startDatetime.Format(dateFormat), endDatetime.Format(dateFormat), int64(0),
+		).WillReturnRows(
+			sqlmock.NewRows([]string{"ID", "PREDMET", "DEPARTMENT"}).AddRow(10, "name 10", "кафедра"),
+		)
+
+		writer := mocks.NewWriterInterface(t)
+		writer.On(
+			"WriteMessages",
+			mock.MatchedBy(func(ctx context.Context) bool { return true }),
+			mock.MatchedBy(func(message kafka.Message) bool {
+				var extendedEvent DisciplineEventV2
+				err = json.Unmarshal(message.Value, &extendedEvent)
+				return assert.NoError(t, err) &&
+					assert.Equal(t, events.DisciplineEventName, string(message.Key)) &&
+					assert.Equal(t, DisciplinePayloadVersion2, extendedEvent.Version) &&
+					assert.Equal(t, uint(10), extendedEvent.Id) &&
+					assert.Equal(t, "name 10", extendedEvent.Name) &&
+					assert.Equal(t, year, extendedEvent.Year) &&
+					assert.Equal(t, "кафедра", extendedEvent.Department)
+			}),
+		).Return(nil)
+
 		importer := Importer{
 			out:            &out,
 			db:             db,
 			writer:         writer,
-			writeThreshold: 3,
+			batch:          BatchPolicy{maxCount: 3},
+			payloadVersion: DisciplinePayloadVersion2,
+			query: DisciplineEnrichment{
+				Joins:      "LEFT JOIN T_KAF ON T_KAF.ID = T_PD_CMS.KAF_ID",
+				Department: "T_KAF.NAME",
+			}.buildQuery(FirebirdDialect),
 		}
 
-		err = importer.execute(startDatetime, endDatetime, year)
+		err = importer.execute(context.Background(), ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year})
+		assert.NoError(t, err)
+
+		err = dbMock.ExpectationsWereMet()
+		assert.NoErrorf(t, err, "there were unfulfilled expectations: %s", err)
+	})
+
+	t.Run("query with custom params and columns", func(t *testing.T) {
+		startDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
+		endDatetime = time.Date(2023, 3, 6, 4, 0, 0, 0, time.Local)
+
+		db, dbMock, err := sqlmock.New()
+		if err != nil {
+			log.Fatalf("an error '%s' was not expected when opening a mock database connection", err)
+		}
+
+		dbMock.ExpectQuery(`SELECT D.ID AS DISCIPLINE_ID, D.TITLE, D.CODE FROM DISCIPLINES D`).WithArgs(
+			year, startDatetime.Format(dateFormat), endDatetime.Format(dateFormat),
+		).WillReturnRows(
+			sqlmock.NewRows([]string{"discipline_id", "title", "code"}).AddRow(10, " name 10 ", "ignored"),
+		)
+
+		writer := mocks.NewWriterInterface(t)
+		writer.On(
+			"WriteMessages",
+			mock.MatchedBy(func(ctx context.Context) bool { return true }),
+			mock.MatchedBy(func(message kafka.Message) bool {
+				err = json.Unmarshal(message.Value, &event)
+				return assert.NoError(t, err) &&
+					assert.Equal(t, uint(10), event.Id) &&
+					assert.Equal(t, "name 10", event.Name)
+			}),
+		).Return(nil)
+
+		importer := Importer{
+			out:    &out,
+			db:     db,
+			writer: writer,
+			batch:  BatchPolicy{maxCount: 3},
+			query: DisciplinesQuery{
+				Query:   "SELECT D.ID AS DISCIPLINE_ID, D.TITLE, D.CODE FROM DISCIPLINES D WHERE D.YEAR = ? AND D.REGDATE BETWEEN ? AND ?",
+				Params:  []string{YearParam, StartDatetimeParam, EndDatetimeParam},
+				Columns: map[string]string{"DISCIPLINE_ID": IdField, "TITLE": NameField},
+			},
+		}
 
+		err = importer.execute(context.Background(), ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year})
 		assert.NoError(t, err)
 
 		err = dbMock.ExpectationsWereMet()
 		assert.NoErrorf(t, err, "there were unfulfilled expectations: %s", err)
-		writer.AssertNumberOfCalls(t, "WriteMessages", 2)
+	})
 
-		writer.AssertExpectations(t)
+	t.Run("sqlite mirror", func(t *testing.T) {
+		startDatetime = time.Date(2023, 3, 5, 0, 0, 0, 0, time.Local)
+		endDatetime = time.Date(2023, 3, 6, 0, 0, 0, 0, time.Local)
+
+		db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "dekanat.sqlite"))
+		assert.NoError(t, err)
+		defer db.Close()
+
+		_, err = db.Exec(`
+			CREATE TABLE TPR_COLL (ID INTEGER PRIMARY KEY, PREDMET TEXT);
+			CREATE TABLE T_PD_CMS (ID INTEGER PRIMARY KEY, PREDM_ID INTEGER, REGDATE TEXT);
+			INSERT INTO TPR_COLL VALUES (1, ' name 10 '), (2, 'name 11');
+			INSERT INTO T_PD_CMS VALUES (10, 1, '2023-03-05 04:00:00'), (11, 2, '2023-03-07 04:00:00');
+		`)
+		assert.NoError(t, err)
+
+		writer := mocks.NewWriterInterface(t)
+		writer.On(
+			"WriteMessages",
+			mock.MatchedBy(func(ctx context.Context) bool { return true }),
+			mock.MatchedBy(func(message kafka.Message) bool {
+				err = json.Unmarshal(message.Value, &event)
+				return assert.NoError(t, err) &&
+					assert.Equal(t, uint(10), event.Id) &&
+					assert.Equal(t, "name 10", event.Name)
+			}),
+		).Return(nil)
+
+		importer := Importer{
+			out:     &out,
+			db:      db,
+			writer:  writer,
+			batch:   BatchPolicy{maxCount: 3},
+			dialect: SqliteDialect,
+			query:   DisciplineEnrichment{}.buildQuery(SqliteDialect),
+		}
+
+		err = importer.execute(context.Background(), ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year})
+		assert.NoError(t, err)
+		writer.AssertNumberOfCalls(t, "WriteMessages", 1)
+	})
+
+	t.Run("postgres placeholders and datetime", func(t *testing.T) {
+		startDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
+		endDatetime = time.Date(2023, 3, 6, 4, 0, 0, 0, time.Local)
+
+		db, dbMock, err := sqlmock.New()
+		if err != nil {
+			log.Fatalf("an error '%s' was not expected when opening a mock database connection", err)
+		}
+
+		dbMock.ExpectQuery(`WHERE "T_PD_CMS"."REGDATE" BETWEEN \$1 AND \$2`).WithArgs(
+			startDatetime, endDatetime, int64(0),
+		).WillReturnRows(sqlmock.NewRows(expectedColumns))
+
+		importer := Importer{
+			out:     &out,
+			db:      db,
+			writer:  mocks.NewWriterInterface(t),
+			batch:   BatchPolicy{maxCount: 3},
+			dialect: PostgresDialect,
+			query:   DisciplineEnrichment{}.buildQuery(PostgresDialect),
+		}
+
+		err = importer.execute(context.Background(), ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year})
+		assert.NoError(t, err)
+
+		err = dbMock.ExpectationsWereMet()
+		assert.NoErrorf(t, err, "there were unfulfilled expectations: %s", err)
+	})
+
+	t.Run("normalize name and keep raw one", func(t *testing.T) {
+		startDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
+		endDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
+		rawName := " Iноземна\u00a0 мова "
+
+		db, dbMock, err := sqlmock.New()
+		if err != nil {
+			log.Fatalf("an error '%s' was not expected when opening a mock database connection", err)
+		}
+		dbMock.ExpectQuery(expectedQuery).WillReturnRows(sqlmock.NewRows(expectedColumns).AddRow(10, rawName))
+
+		writer := mocks.NewWriterInterface(t)
+		writer.On(
+			"WriteMessages",
+			mock.MatchedBy(func(ctx context.Context) bool { return true }),
+			mock.MatchedBy(func(message kafka.Message) bool {
+				var extendedEvent DisciplineEventV2
+				err = json.Unmarshal(message.Value, &extendedEvent)
+				return assert.NoError(t, err) &&
+					assert.Equal(t, "Іноземна мова", extendedEvent.Name) &&
+					assert.Equal(t, rawName, extendedEvent.RawName)
+			}),
+		).Return(nil)
+
+		normalizer, _ := parseNameNormalizer("")
+		importer := Importer{
+			out:            &out,
+			db:             db,
+			writer:         writer,
+			batch:          BatchPolicy{maxCount: 3},
+			payloadVersion: DisciplinePayloadVersion2,
+			normalizer:     normalizer,
+			keepRawName:    true,
+		}
+
+		err = importer.execute(context.Background(), ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year})
+		assert.NoError(t, err)
 	})
 
 	t.Run("sql error", func(t *testing.T) {
@@ -115,7 +545,7 @@ func TestImporterExecute(t *testing.T) {
 		}
 
 		dbMock.ExpectQuery(expectedQuery).WithArgs(
-			startDatetime.Format(dateFormat), endDatetime.Format(dateFormat),
+			startDatetime.Format(dateFormat), endDatetime.Format(dateFormat), int64(0),
 		).WillReturnError(expectedError)
 		// End Init DB Mock
 
@@ -124,13 +554,13 @@ func TestImporterExecute(t *testing.T) {
 		// End Init Writer Mock and Expectation
 
 		importer := Importer{
-			out:            &out,
-			db:             db,
-			writer:         writer,
-			writeThreshold: 3,
+			out:    &out,
+			db:     db,
+			writer: writer,
+			batch:  BatchPolicy{maxCount: 3},
 		}
 
-		err = importer.execute(startDatetime, endDatetime, year)
+		err = importer.execute(context.Background(), ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year})
 
 		assert.Error(t, err)
 		assert.Equal(t, expectedError, err)
@@ -158,7 +588,7 @@ func TestImporterExecute(t *testing.T) {
 		).AddRow("sadsad", nil)
 
 		dbMock.ExpectQuery(expectedQuery).WithArgs(
-			startDatetime.Format(dateFormat), endDatetime.Format(dateFormat),
+			startDatetime.Format(dateFormat), endDatetime.Format(dateFormat), int64(0),
 		).WillReturnRows(rows)
 		// End Init DB Mock
 
@@ -185,13 +615,13 @@ func TestImporterExecute(t *testing.T) {
 		// End Init Writer Mock and Expectation
 
 		importer := Importer{
-			out:            &out,
-			db:             db,
-			writer:         writer,
-			writeThreshold: 3,
+			out:    &out,
+			db:     db,
+			writer: writer,
+			batch:  BatchPolicy{maxCount: 3},
 		}
 
-		err = importer.execute(startDatetime, endDatetime, year)
+		err = importer.execute(context.Background(), ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year})
 
 		assert.Error(t, err)
 		assert.ErrorContains(t, err, "sql: Scan error on column index ")
@@ -203,6 +633,223 @@ func TestImporterExecute(t *testing.T) {
 		writer.AssertExpectations(t)
 	})
 
+	t.Run("quarantine invalid rows", func(t *testing.T) {
+		startDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
+		endDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
+
+		fingerprints, err := NewFingerprintStore(filepath.Join(t.TempDir(), "fingerprints.json"))
+		assert.NoError(t, err)
+		fingerprints.set(year, 30, testDisciplineFingerprint(30, "name 30", year))
+
+		db, dbMock, err := sqlmock.New()
+		if err != nil {
+			log.Fatalf("an error '%s' was not expected when opening a mock database connection", err)
+		}
+
+		rows := sqlmock.NewRows(expectedColumns).
+			AddRow(20, "name 20").
+			AddRow("sadsad", "name").
+			AddRow(21, nil).
+			AddRow(22, " \t ").
+			AddRow(23, "name 23")
+
+		dbMock.ExpectQuery(expectedQuery).WillReturnRows(rows)
+
+		writer := mocks.NewWriterInterface(t)
+		writer.On(
+			"WriteMessages",
+			mock.MatchedBy(func(ctx context.Context) bool { return true }),
+			mock.Anything, mock.Anything,
+		).Return(nil)
+
+		var deadLetterOut bytes.Buffer
+		importer := Importer{
+			out:            &out,
+			db:             db,
+			writer:         writer,
+			batch:          BatchPolicy{maxCount: 3},
+			fingerprints:   fingerprints,
+			normalizer:     NameNormalizer{"whitespace"},
+			deadLetter:     NewJsonlWriter(&deadLetterOut),
+			maxInvalidRows: 3,
+		}
+
+		err = importer.execute(context.Background(), ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year, FullImport: true})
+		assert.NoError(t, err)
+		writer.AssertNumberOfCalls(t, "WriteMessages", 1)
+
+		// removals are not published when some rows are quarantined
+		assert.Equal(t, []uint{20, 23, 30}, fingerprints.ids(year))
+
+		lines := strings.Split(strings.TrimSpace(deadLetterOut.String()), "\n")
+		assert.Len(t, lines, 3)
+
+		var record struct {
+			Key   string
+			Value DisciplineDeadLetter
+		}
+		_ = json.Unmarshal([]byte(lines[0]), &record)
+		assert.Equal(t, DisciplineDeadLetterEventName, record.Key)
+		assert.Equal(t, year, record.Value.Year)
+		assert.Contains(t, record.Value.Error, "sql: Scan error on column index 0")
+		assert.Equal(t, map[string]any{"ID": "sadsad", "PREDMET": "name"}, record.Value.Row)
+
+		_ = json.Unmarshal([]byte(lines[1]), &record)
+		assert.Equal(t, map[string]any{"ID": float64(21), "PREDMET": nil}, record.Value.Row)
+
+		_ = json.Unmarshal([]byte(lines[2]), &record)
+		assert.Equal(t, errEmptyDisciplineName.Error(), record.Value.Error)
+
+		err = dbMock.ExpectationsWereMet()
+		assert.NoErrorf(t, err, "there were unfulfilled expectations: %s", err)
+	})
+
+	t.Run("invalid rows budget exceeded", func(t *testing.T) {
+		db, dbMock, err := sqlmock.New()
+		if err != nil {
+			log.Fatalf("an error '%s' was not expected when opening a mock database connection", err)
+		}
+
+		dbMock.ExpectQuery(expectedQuery).WillReturnRows(
+			sqlmock.NewRows(expectedColumns).AddRow(20, nil).AddRow(21, nil).AddRow(22, "name 22"),
+		)
+
+		var deadLetterOut bytes.Buffer
+		importer := Importer{
+			out:            &out,
+			db:             db,
+			writer:         mocks.NewWriterInterface(t),
+			batch:          BatchPolicy{maxCount: 3},
+			deadLetter:     NewJsonlWriter(&deadLetterOut),
+			maxInvalidRows: 1,
+		}
+
+		err = importer.execute(context.Background(), ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year})
+		assert.EqualError(t, err, "invalid rows budget exceeded: 2 invalid rows, allowed 1")
+		assert.Equal(t, 2, strings.Count(deadLetterOut.String(), "\n"))
+	})
+
+	t.Run("cancel import drains current batch", func(t *testing.T) {
+		startDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
+		endDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		fingerprints, err := NewFingerprintStore(filepath.Join(t.TempDir(), "fingerprints.json"))
+		assert.NoError(t, err)
+		fingerprints.set(year, 40, testDisciplineFingerprint(40, "name 40", year))
+
+		db, dbMock, err := sqlmock.New()
+		if err != nil {
+			log.Fatalf("an error '%s' was not expected when opening a mock database connection", err)
+		}
+
+		rows := sqlmock.NewRows(expectedColumns)
+		for i := 10; i < 16; i++ {
+			rows = rows.AddRow(i, "name "+strconv.Itoa(i))
+		}
+		dbMock.ExpectQuery(expectedQuery).WillReturnRows(rows)
+
+		notCancelledContext := mock.MatchedBy(func(ctx context.Context) bool { return ctx.Err() == nil })
+
+		writer := mocks.NewWriterInterface(t)
+		writer.On("WriteMessages", notCancelledContext, mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) { cancel() }).
+			Return(nil).Once()
+		writer.On("WriteMessages", notCancelledContext, mock.Anything).Return(nil).Once()
+
+		importer := Importer{
+			out:          &out,
+			db:           db,
+			writer:       writer,
+			batch:        BatchPolicy{maxCount: 2},
+			fingerprints: fingerprints,
+		}
+
+		err = importer.execute(ctx, ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year, FullImport: true})
+
+		assert.Equal(t, context.Canceled, err)
+		writer.AssertNumberOfCalls(t, "WriteMessages", 2)
+		// drained batch is stored, removals are not published for incomplete import
+		assert.Equal(t, []uint{10, 11, 12, 40}, fingerprints.ids(year))
+	})
+
+	t.Run("resume import from checkpoint", func(t *testing.T) {
+		startDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
+		endDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
+		expectedError := errors.New("expected test error")
+
+		checkpoints, err := NewCheckpointStore(filepath.Join(t.TempDir(), "checkpoints.json"))
+		assert.NoError(t, err)
+		fingerprints, err := NewFingerprintStore(filepath.Join(t.TempDir(), "fingerprints.json"))
+		assert.NoError(t, err)
+		fingerprints.set(year, 40, testDisciplineFingerprint(40, "name 40", year))
+
+		db, dbMock, err := sqlmock.New()
+		if err != nil {
+			log.Fatalf("an error '%s' was not expected when opening a mock database connection", err)
+		}
+
+		newRows := func(from int) *sqlmock.Rows {
+			rows := sqlmock.NewRows(expectedColumns)
+			for i := from; i < 16; i++ {
+				rows = rows.AddRow(i, "name "+strconv.Itoa(i))
+			}
+			return rows
+		}
+		dbMock.ExpectQuery(expectedQuery).WithArgs(
+			startDatetime.Format(dateFormat), endDatetime.Format(dateFormat), int64(0),
+		).WillReturnRows(newRows(10))
+		dbMock.ExpectQuery(expectedQuery).WithArgs(
+			startDatetime.Format(dateFormat), endDatetime.Format(dateFormat), int64(11),
+		).WillReturnRows(newRows(12))
+
+		matchContext := mock.MatchedBy(func(ctx context.Context) bool { return true })
+		writer := mocks.NewWriterInterface(t)
+		writer.On("WriteMessages", matchContext, mock.Anything, mock.Anything).Return(nil).Once()
+		writer.On("WriteMessages", matchContext, mock.Anything, mock.Anything).Return(expectedError).Once()
+
+		importer := Importer{
+			out:          &out,
+			db:           db,
+			writer:       writer,
+			batch:        BatchPolicy{maxCount: 2},
+			fingerprints: fingerprints,
+			checkpoints:  checkpoints,
+		}
+
+		task := ImportTask{
+			StartDatetime:   startDatetime,
+			EndDatetime:     endDatetime,
+			Year:            year,
+			FullImport:      true,
+			SourceTopic:     "meta_events",
+			SourcePartition: 1,
+			SourceOffset:    20,
+		}
+
+		err = importer.execute(context.Background(), task)
+		assert.Equal(t, expectedError, err)
+
+		lastId, exists := checkpoints.get("meta_events/1/20")
+		assert.True(t, exists)
+		assert.Equal(t, uint(11), lastId)
+
+		writer.On("WriteMessages", matchContext, mock.Anything, mock.Anything).Return(nil).Twice()
+
+		err = importer.execute(context.Background(), task)
+		assert.NoError(t, err)
+		writer.AssertNumberOfCalls(t, "WriteMessages", 4)
+
+		_, exists = checkpoints.get("meta_events/1/20")
+		assert.False(t, exists)
+		// resumed import has not seen all disciplines, so removals are not published
+		assert.Equal(t, []uint{10, 11, 12, 13, 14, 15, 40}, fingerprints.ids(year))
+
+		err = dbMock.ExpectationsWereMet()
+		assert.NoErrorf(t, err, "there were unfulfilled expectations: %s", err)
+	})
+
 	t.Run("writer error", func(t *testing.T) {
 		startDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
 		endDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
@@ -222,7 +869,7 @@ func TestImporterExecute(t *testing.T) {
 		)
 
 		dbMock.ExpectQuery(expectedQuery).WithArgs(
-			startDatetime.Format(dateFormat), endDatetime.Format(dateFormat),
+			startDatetime.Format(dateFormat), endDatetime.Format(dateFormat), int64(0),
 		).WillReturnRows(rows)
 		// End Init DB Mock
 
@@ -237,13 +884,13 @@ func TestImporterExecute(t *testing.T) {
 		// End Init Writer Mock and Expectation
 
 		importer := Importer{
-			out:            &out,
-			db:             db,
-			writer:         writer,
-			writeThreshold: 1,
+			out:    &out,
+			db:     db,
+			writer: writer,
+			batch:  BatchPolicy{maxCount: 1},
 		}
 
-		err = importer.execute(startDatetime, endDatetime, year)
+		err = importer.execute(context.Background(), ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year})
 
 		assert.Error(t, err)
 		assert.Equal(t, expectedError, err)
@@ -255,23 +902,512 @@ func TestImporterExecute(t *testing.T) {
 		writer.AssertExpectations(t)
 	})
 
-	t.Run("db ping fails", func(t *testing.T) {
+	t.Run("only written disciplines are counted as sent", func(t *testing.T) {
+		expectedError := errors.New("expected test error")
+
+		db, dbMock, err := sqlmock.New()
+		assert.NoError(t, err)
+
+		rows := sqlmock.NewRows(expectedColumns).AddRow(10, "name 10").AddRow(11, "name 11").AddRow(12, "name 12")
+		dbMock.ExpectQuery(expectedQuery).WithArgs(
+			startDatetime.Format(dateFormat), endDatetime.Format(dateFormat), int64(0),
+		).WillReturnRows(rows)
+
+		writer := mocks.NewWriterInterface(t)
+		writer.On(
+			"WriteMessages", mock.MatchedBy(func(ctx context.Context) bool { return true }), mock.Anything, mock.Anything,
+		).Return(nil).Once()
+		writer.On(
+			"WriteMessages", mock.MatchedBy(func(ctx context.Context) bool { return true }), mock.Anything,
+		).Return(expectedError).Once()
+
+		var finished DisciplinesImportFinishedEvent
+		lifecycle := mocks.NewWriterInterface(t)
+		lifecycle.On(
+			"WriteMessages",
+			mock.MatchedBy(func(ctx context.Context) bool { return true }),
+			mock.MatchedBy(func(message kafka.Message) bool {
+				return json.Unmarshal(message.Value, &finished) == nil
+			}),
+		).Return(nil).Twice()
+
+		out.Reset()
+		importer := Importer{
+			out:       &out,
+			db:        db,
+			writer:    writer,
+			batch:     BatchPolicy{maxCount: 2},
+			lifecycle: lifecycle,
+		}
+
+		err = importer.execute(context.Background(), ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year})
+
+		assert.Equal(t, expectedError, err)
+		assert.Equal(t, 2, finished.Sent)
+		assert.Contains(t, out.String(), "Send 2 disciplines")
+	})
+
+	t.Run("lifecycle events", func(t *testing.T) {
+		startDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
+		endDatetime = time.Date(2023, 3, 6, 4, 0, 0, 0, time.Local)
+
+		db, dbMock, err := sqlmock.New()
+		assert.NoError(t, err)
+
+		rows := sqlmock.NewRows(expectedColumns).AddRow(10, "name 10").AddRow(11, "name 11")
+		dbMock.ExpectQuery(expectedQuery).WithArgs(
+			startDatetime.Format(dateFormat), endDatetime.Format(dateFormat), int64(0),
+		).WillReturnRows(rows)
+
+		writer := mocks.NewWriterInterface(t)
+		writer.On(
+			"WriteMessages", mock.MatchedBy(func(ctx context.Context) bool { return true }), mock.Anything, mock.Anything,
+		).Return(nil)
+
+		var started DisciplinesImportStartedEvent
+		var finished DisciplinesImportFinishedEvent
+		lifecycle := mocks.NewWriterInterface(t)
+		lifecycle.On(
+			"WriteMessages",
+			mock.MatchedBy(func(ctx context.Context) bool { return true }),
+			mock.MatchedBy(func(message kafka.Message) bool {
+				return string(message.Key) == DisciplinesImportStartedEventName &&
+					assert.NoError(t, json.Unmarshal(message.Value, &started))
+			}),
+		).Return(nil).Once()
+		lifecycle.On(
+			"WriteMessages",
+			mock.MatchedBy(func(ctx context.Context) bool { return true }),
+			mock.MatchedBy(func(message kafka.Message) bool {
+				return string(message.Key) == DisciplinesImportFinishedEventName &&
+					assert.NoError(t, json.Unmarshal(message.Value, &finished))
+			}),
+		).Return(nil).Once()
+
+		importer := Importer{
+			out:       &out,
+			db:        db,
+			writer:    writer,
+			batch:     BatchPolicy{maxCount: 10},
+			lifecycle: lifecycle,
+		}
+
+		task := ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year, FullImport: true}
+		err = importer.execute(context.Background(), task)
+
+		assert.NoError(t, err)
+		assert.NotEmpty(t, started.RunId)
+		assert.Equal(t, year, started.Year)
+		assert.True(t, started.StartDatetime.Equal(startDatetime))
+		assert.True(t, started.FullImport)
+		assert.Equal(t, started, finished.DisciplinesImportStartedEvent)
+		assert.Equal(t, 2, finished.Sent)
+		assert.Empty(t, finished.Error)
+		lifecycle.AssertNumberOfCalls(t, "WriteMessages", 2)
+	})
+
+	t.Run("lifecycle events on failed import", func(t *testing.T) {
 		expectedErr := errors.New("ping error")
 
 		db, dbMock, _ := sqlmock.New(sqlmock.MonitorPingsOption(true))
 		dbMock.ExpectPing().WillReturnError(expectedErr)
 
+		var finished DisciplinesImportFinishedEvent
+		lifecycle := mocks.NewWriterInterface(t)
+		lifecycle.On(
+			"WriteMessages",
+			mock.MatchedBy(func(ctx context.Context) bool { return true }),
+			mock.MatchedBy(func(message kafka.Message) bool {
+				return json.Unmarshal(message.Value, &finished) == nil
+			}),
+		).Return(nil).Twice()
+
+		importer := Importer{
+			out:       &out,
+			db:        db,
+			lifecycle: lifecycle,
+		}
+
+		err := importer.execute(context.Background(), ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year})
+
+		assert.Equal(t, expectedErr, err)
+		assert.Equal(t, "ping error", finished.Error)
+	})
+
+	t.Run("secrets are redacted in error of finished event", func(t *testing.T) {
+		db, dbMock, _ := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		dbMock.ExpectPing().WillReturnError(errors.New(`Post "http://hooks/in?token=S3CRET": refused`))
+
+		var finished DisciplinesImportFinishedEvent
+		lifecycle := mocks.NewWriterInterface(t)
+		lifecycle.On(
+			"WriteMessages",
+			mock.MatchedBy(func(ctx context.Context) bool { return true }),
+			mock.MatchedBy(func(message kafka.Message) bool {
+				return json.Unmarshal(message.Value, &finished) == nil
+			}),
+		).Return(nil).Twice()
+
+		importer := Importer{
+			out:       &out,
+			db:        db,
+			lifecycle: lifecycle,
+			secrets:   Config{sinks: []SinkConfig{{webhookUrl: "http://hooks/in?token=S3CRET"}}}.secretsReplacer(),
+		}
+
+		err := importer.execute(context.Background(), ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year})
+
+		assert.EqualError(t, err, `Post "http://hooks/in?*****": refused`)
+		assert.Equal(t, `Post "http://hooks/in?*****": refused`, finished.Error)
+	})
+
+	t.Run("lifecycle writer error", func(t *testing.T) {
+		expectedErr := errors.New("lifecycle error")
+
+		db, _, _ := sqlmock.New()
+		lifecycle := mocks.NewWriterInterface(t)
+		lifecycle.On("WriteMessages", mock.MatchedBy(func(ctx context.Context) bool { return true }), mock.Anything).
+			Return(expectedErr).Once()
+
+		importer := Importer{
+			out:       &out,
+			db:        db,
+			lifecycle: lifecycle,
+		}
+
+		err := importer.execute(context.Background(), ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year})
+
+		assert.Equal(t, expectedErr, err)
+	})
+
+	t.Run("message headers", func(t *testing.T) {
+		startDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
+		endDatetime = time.Date(2023, 3, 6, 4, 0, 0, 0, time.Local)
+
+		db, dbMock, err := sqlmock.New()
+		assert.NoError(t, err)
+
+		rows := sqlmock.NewRows(expectedColumns).AddRow(10, "name 10")
+		dbMock.ExpectQuery(expectedQuery).WithArgs(
+			startDatetime.Format(dateFormat), endDatetime.Format(dateFormat), int64(0),
+		).WillReturnRows(rows)
+
+		parentTraceId := "0af7651916cd43dd8448eb211c80319c"
+		var runId string
+		headersMatcher := func(message kafka.Message) bool {
+			if runId == "" {
+				runId = messageHeader(message, RunIdHeader)
+			}
+
+			return assert.NotEmpty(t, runId) &&
+				assert.Equal(t, runId, messageHeader(message, RunIdHeader)) &&
+				assert.Equal(t, "meta-events", messageHeader(message, SourceTopicHeader)) &&
+				assert.Equal(t, "2", messageHeader(message, SourcePartitionHeader)) &&
+				assert.Equal(t, "300", messageHeader(message, SourceOffsetHeader)) &&
+				assert.Equal(t, "firebirdsql:HOST/DATABASE", messageHeader(message, SourceDbHeader)) &&
+				assert.Contains(t, messageHeader(message, TraceparentHeader), parentTraceId)
+		}
+
+		writer := mocks.NewWriterInterface(t)
+		writer.On(
+			"WriteMessages",
+			mock.MatchedBy(func(ctx context.Context) bool { return true }),
+			mock.MatchedBy(func(message kafka.Message) bool {
+				return headersMatcher(message) && assert.Equal(t, "2", messageHeader(message, SchemaVersionHeader))
+			}),
+		).Return(nil)
+
+		lifecycle := mocks.NewWriterInterface(t)
+		lifecycle.On(
+			"WriteMessages",
+			mock.MatchedBy(func(ctx context.Context) bool { return true }),
+			mock.MatchedBy(headersMatcher),
+		).Return(nil).Twice()
+
 		importer := Importer{
 			out:            &out,
 			db:             db,
-			writer:         nil,
-			writeThreshold: 3,
+			writer:         writer,
+			batch:          BatchPolicy{maxCount: 10},
+			payloadVersion: DisciplinePayloadVersion2,
+			lifecycle:      lifecycle,
+			sourceDb:       "firebirdsql:HOST/DATABASE",
+			tracing:        true,
+		}
+
+		err = importer.execute(context.Background(), ImportTask{
+			StartDatetime:   startDatetime,
+			EndDatetime:     endDatetime,
+			Year:            year,
+			SourceTopic:     "meta-events",
+			SourcePartition: 2,
+			SourceOffset:    300,
+			Traceparent:     "00-" + parentTraceId + "-b7ad6b7169203331-01",
+		})
+
+		assert.NoError(t, err)
+		writer.AssertNumberOfCalls(t, "WriteMessages", 1)
+	})
+
+	t.Run("wait until outbox is drained", func(t *testing.T) {
+		startDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
+		endDatetime = time.Date(2023, 3, 6, 4, 0, 0, 0, time.Local)
+
+		db, dbMock, err := sqlmock.New()
+		assert.NoError(t, err)
+
+		rows := sqlmock.NewRows(expectedColumns).AddRow(10, "name 10")
+		dbMock.ExpectQuery(expectedQuery).WithArgs(
+			startDatetime.Format(dateFormat), endDatetime.Format(dateFormat), int64(0),
+		).WillReturnRows(rows)
+
+		kafkaWriter := mocks.NewWriterInterface(t)
+		kafkaWriter.On("WriteMessages", mock.MatchedBy(func(ctx context.Context) bool { return true }), mock.Anything).
+			Return(errors.New("kafka is unavailable")).Once()
+
+		outbox, err := NewOutbox(t.TempDir(), kafkaWriter, time.Second, &out)
+		assert.NoError(t, err)
+
+		importer := Importer{
+			out:    &out,
+			db:     db,
+			writer: outbox,
+			batch:  BatchPolicy{maxCount: 10},
+			outbox: outbox,
 		}
 
-		err := importer.execute(startDatetime, endDatetime, year)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+		defer cancel()
+
+		err = importer.execute(ctx, ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		kafkaWriter.On("WriteMessages", mock.MatchedBy(func(ctx context.Context) bool { return true }), mock.Anything).
+			Return(nil).Once()
+		assert.NoError(t, outbox.flush(context.Background()))
+
+		segments, _ := outbox.segments()
+		assert.Empty(t, segments)
+	})
+
+	t.Run("flush batch by bytes", func(t *testing.T) {
+		startDatetime = time.Date(2023, 3, 5, 4, 0, 0, 0, time.Local)
+		endDatetime = time.Date(2023, 3, 6, 4, 0, 0, 0, time.Local)
+
+		db, dbMock, err := sqlmock.New()
+		assert.NoError(t, err)
+
+		rows := sqlmock.NewRows(expectedColumns).AddRow(10, "name 10").AddRow(11, "name 11").AddRow(12, "name 12")
+		dbMock.ExpectQuery(expectedQuery).WithArgs(
+			startDatetime.Format(dateFormat), endDatetime.Format(dateFormat), int64(0),
+		).WillReturnRows(rows)
+
+		writer := mocks.NewWriterInterface(t)
+		writer.On(
+			"WriteMessages", mock.MatchedBy(func(ctx context.Context) bool { return true }), mock.Anything, mock.Anything,
+		).Return(nil).Once()
+		writer.On(
+			"WriteMessages", mock.MatchedBy(func(ctx context.Context) bool { return true }), mock.Anything,
+		).Return(nil).Once()
+
+		var finished DisciplinesImportFinishedEvent
+		lifecycle := mocks.NewWriterInterface(t)
+		lifecycle.On(
+			"WriteMessages",
+			mock.MatchedBy(func(ctx context.Context) bool { return true }),
+			mock.MatchedBy(func(message kafka.Message) bool {
+				return json.Unmarshal(message.Value, &finished) == nil
+			}),
+		).Return(nil).Twice()
+
+		// every message is about 200 bytes with headers, so only two of them fit into the batch
+		importer := Importer{
+			out:       &out,
+			db:        db,
+			writer:    writer,
+			batch:     BatchPolicy{maxCount: 10, maxBytes: 500},
+			lifecycle: lifecycle,
+		}
+
+		err = importer.execute(context.Background(), ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year})
+
+		assert.NoError(t, err)
+		writer.AssertNumberOfCalls(t, "WriteMessages", 2)
+		assert.Equal(t, 2, finished.Batches.Batches)
+		assert.Equal(t, 3, finished.Batches.Messages)
+		assert.Equal(t, 1, finished.Batches.ByBytes)
+		assert.Equal(t, 1, finished.Batches.ByEnd)
+		assert.LessOrEqual(t, finished.Batches.MaxBatchBytes, 500)
+	})
+
+	t.Run("flush batch by linger while waiting for rows", func(t *testing.T) {
+		connector := &waitingRowsConnector{
+			rows:    [][]driver.Value{{int64(10), "name 10"}, {int64(11), "name 11"}},
+			release: make(chan struct{}),
+		}
+
+		writer := mocks.NewWriterInterface(t)
+		writer.On(
+			"WriteMessages", mock.MatchedBy(func(ctx context.Context) bool { return true }), mock.Anything,
+		).Run(func(args mock.Arguments) {
+			close(connector.release)
+		}).Return(nil).Once()
+		writer.On(
+			"WriteMessages", mock.MatchedBy(func(ctx context.Context) bool { return true }), mock.Anything,
+		).Return(nil).Once()
+
+		var finished DisciplinesImportFinishedEvent
+		lifecycle := mocks.NewWriterInterface(t)
+		lifecycle.On(
+			"WriteMessages",
+			mock.MatchedBy(func(ctx context.Context) bool { return true }),
+			mock.MatchedBy(func(message kafka.Message) bool {
+				return json.Unmarshal(message.Value, &finished) == nil
+			}),
+		).Return(nil).Twice()
+
+		importer := Importer{
+			out:       &out,
+			db:        sql.OpenDB(connector),
+			writer:    writer,
+			batch:     BatchPolicy{maxCount: 10, linger: time.Millisecond * 20},
+			lifecycle: lifecycle,
+		}
+
+		startedAt := time.Now()
+		err := importer.execute(context.Background(), ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year})
+
+		assert.NoError(t, err)
+		assert.Less(t, time.Since(startedAt), waitingRowsTimeout, "the first row is written before the second one is read")
+		writer.AssertNumberOfCalls(t, "WriteMessages", 2)
+		assert.Equal(t, 2, finished.Batches.Batches)
+		assert.Equal(t, 1, finished.Batches.ByLinger)
+		assert.Equal(t, 1, finished.Batches.ByEnd)
+	})
+
+	t.Run("db ping fails", func(t *testing.T) {
+		expectedErr := errors.New("ping error")
+
+		db, dbMock, _ := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		dbMock.ExpectPing().WillReturnError(expectedErr)
+
+		importer := Importer{
+			out:    &out,
+			db:     db,
+			writer: nil,
+			batch:  BatchPolicy{maxCount: 3},
+		}
+
+		err := importer.execute(context.Background(), ImportTask{StartDatetime: startDatetime, EndDatetime: endDatetime, Year: year})
 
 		assert.Error(t, err)
 		assert.Equal(t, expectedErr, err)
 	})
 
 }
+
+func TestImportTaskCheckpointKey(t *testing.T) {
+	task := ImportTask{
+		StartDatetime: time.Date(2023, 3, 5, 4, 0, 0, 0, time.UTC),
+		EndDatetime:   time.Date(2023, 3, 6, 4, 0, 0, 0, time.UTC),
+		Year:          2030,
+	}
+	assert.Equal(t, "2023-03-05T04:00:00Z/2023-03-06T04:00:00Z/2030", task.checkpointKey())
+
+	task.SourceTopic = "meta_events"
+	task.SourcePartition = 2
+	task.SourceOffset = 300
+	assert.Equal(t, "meta_events/2/300", task.checkpointKey())
+}
+
+func testDisciplineFingerprint(id uint, name string, year int) string {
+	event := events.DisciplineEvent{Year: year}
+	event.Id = id
+	event.Name = name
+	payload, _ := json.Marshal(event)
+
+	return disciplineFingerprint(payload)
+}
+
+func TestWriteContext(t *testing.T) {
+	ctx, cancelImport := context.WithCancel(context.Background())
+	writeCtx, cancel := writeContext(ctx, time.Millisecond*50)
+	defer cancel()
+
+	cancelImport()
+	assert.NoError(t, writeCtx.Err(), "started write is not interrupted by cancellation")
+
+	select {
+	case <-writeCtx.Done():
+	case <-time.After(time.Second):
+		assert.Fail(t, "write is not limited by drain timeout after cancellation")
+	}
+
+	writeCtx, cancel = writeContext(context.Background(), time.Millisecond)
+	time.Sleep(time.Millisecond * 10)
+	assert.NoError(t, writeCtx.Err(), "drain timeout starts only after cancellation")
+	cancel()
+	assert.Error(t, writeCtx.Err())
+}
+
+const waitingRowsTimeout = time.Second
+
+// waitingRowsConnector emulates slow DB: every row after the first one is returned only when release is closed
+// or waitingRowsTimeout is spent.
+type waitingRowsConnector struct {
+	rows    [][]driver.Value
+	release chan struct{}
+}
+
+func (connector *waitingRowsConnector) Connect(context.Context) (driver.Conn, error) {
+	return connector, nil
+}
+
+func (connector *waitingRowsConnector) Driver() driver.Driver {
+	return nil
+}
+
+func (connector *waitingRowsConnector) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (connector *waitingRowsConnector) Close() error {
+	return nil
+}
+
+func (connector *waitingRowsConnector) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (connector *waitingRowsConnector) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return &waitingRows{connector: connector}, nil
+}
+
+type waitingRows struct {
+	connector *waitingRowsConnector
+	next      int
+}
+
+func (rows *waitingRows) Columns() []string {
+	return expectedColumns
+}
+
+func (rows *waitingRows) Close() error {
+	return nil
+}
+
+func (rows *waitingRows) Next(dest []driver.Value) error {
+	if rows.next == len(rows.connector.rows) {
+		return io.EOF
+	}
+	if rows.next != 0 {
+		select {
+		case <-rows.connector.release:
+		case <-time.After(waitingRowsTimeout):
+		}
+	}
+
+	copy(dest, rows.connector.rows[rows.next])
+	rows.next++
+	return nil
+}
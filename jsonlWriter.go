@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/segmentio/kafka-go"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// JsonlRecord is a kafka.Message written as single JSON line; JSON values are embedded as is.
+type JsonlRecord struct {
+	Time    time.Time         `json:"time"`
+	Key     string            `json:"key"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Value   any               `json:"value"`
+}
+
+// JsonlWriter is events.WriterInterface which appends messages to a JSON lines stream.
+type JsonlWriter struct {
+	out    io.Writer
+	closer io.Closer
+	mutex  sync.Mutex
+}
+
+func NewJsonlWriter(out io.Writer) *JsonlWriter {
+	return &JsonlWriter{out: out}
+}
+
+func NewJsonlFileWriter(filename string) (*JsonlWriter, error) {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &JsonlWriter{out: file, closer: file}, nil
+}
+
+func newJsonlRecord(message kafka.Message) JsonlRecord {
+	record := JsonlRecord{
+		Time: message.Time,
+		Key:  string(message.Key),
+	}
+
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+
+	if len(message.Headers) != 0 {
+		record.Headers = make(map[string]string, len(message.Headers))
+		for _, header := range message.Headers {
+			record.Headers[header.Key] = string(header.Value)
+		}
+	}
+
+	if json.Valid(message.Value) {
+		record.Value = json.RawMessage(message.Value)
+	} else if message.Value != nil {
+		record.Value = string(message.Value)
+	}
+
+	return record
+}
+
+func (writer *JsonlWriter) WriteMessages(_ context.Context, messages ...kafka.Message) error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	encoder := json.NewEncoder(writer.out)
+	encoder.SetEscapeHTML(false)
+	for _, message := range messages {
+		if err := encoder.Encode(newJsonlRecord(message)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (writer *JsonlWriter) Close() error {
+	if writer.closer != nil {
+		return writer.closer.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJsonlWriter(t *testing.T) {
+	messageTime := time.Date(2023, 3, 5, 4, 0, 0, 0, time.UTC)
+	messages := []kafka.Message{
+		{
+			Key:     []byte("2030-10"),
+			Value:   []byte(`{"Id":10,"Name":"Право <ЄС>","Year":2030}`),
+			Headers: []kafka.Header{{Key: EventNameHeader, Value: []byte("DisciplineEvent")}},
+			Time:    messageTime,
+		},
+		{
+			Key:  []byte("2030-11"),
+			Time: messageTime,
+		},
+		{
+			Key:   []byte("plain"),
+			Value: []byte("not json"),
+			Time:  messageTime,
+		},
+	}
+
+	t.Run("stream", func(t *testing.T) {
+		var out bytes.Buffer
+		writer := NewJsonlWriter(&out)
+
+		err := writer.WriteMessages(context.Background(), messages...)
+		assert.NoError(t, err)
+		assert.NoError(t, writer.Close())
+
+		assert.Equal(
+			t,
+			`{"time":"2023-03-05T04:00:00Z","key":"2030-10","headers":{"event":"DisciplineEvent"},"value":{"Id":10,"Name":"Право <ЄС>","Year":2030}}`+"\n"+
+				`{"time":"2023-03-05T04:00:00Z","key":"2030-11","value":null}`+"\n"+
+				`{"time":"2023-03-05T04:00:00Z","key":"plain","value":"not json"}`+"\n",
+			out.String(),
+		)
+	})
+
+	t.Run("file", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "messages.jsonl")
+
+		writer, err := NewJsonlFileWriter(filename)
+		assert.NoError(t, err)
+		assert.NoError(t, writer.WriteMessages(context.Background(), messages[0]))
+		assert.NoError(t, writer.Close())
+
+		writer, err = NewJsonlFileWriter(filename)
+		assert.NoError(t, err)
+		assert.NoError(t, writer.WriteMessages(context.Background(), messages[1]))
+		assert.NoError(t, writer.Close())
+
+		content, _ := os.ReadFile(filename)
+		lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+		assert.Len(t, lines, 2)
+
+		var record JsonlRecord
+		assert.NoError(t, json.Unmarshal([]byte(lines[1]), &record))
+		assert.Equal(t, "2030-11", record.Key)
+	})
+
+	t.Run("not writable file", func(t *testing.T) {
+		writer, err := NewJsonlFileWriter(filepath.Join(t.TempDir(), "not-exists", "messages.jsonl"))
+		assert.Error(t, err)
+		assert.Nil(t, writer)
+	})
+}
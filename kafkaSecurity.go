@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	"os"
+	"time"
+)
+
+const (
+	SaslPlain       = "plain"
+	SaslScramSha256 = "scram-sha-256"
+	SaslScramSha512 = "scram-sha-512"
+)
+
+// KafkaSecurityConfig describes TLS and SASL authentication applied both to reader Dialer and writer Transport.
+// TLS is enabled by KAFKA_TLS_ENABLED or by any of CA, certificate and server name settings.
+type KafkaSecurityConfig struct {
+	tlsEnabled    bool
+	tlsCaFile     string
+	tlsCertFile   string
+	tlsKeyFile    string
+	tlsServerName string
+	saslMechanism string
+	saslUsername  string
+	saslPassword  string
+}
+
+func loadKafkaSecurityConfig(source *ConfigSource) (KafkaSecurityConfig, error) {
+	config := KafkaSecurityConfig{
+		tlsCaFile:     source.get("KAFKA_TLS_CA_FILE"),
+		tlsCertFile:   source.get("KAFKA_TLS_CERT_FILE"),
+		tlsKeyFile:    source.get("KAFKA_TLS_KEY_FILE"),
+		tlsServerName: source.get("KAFKA_TLS_SERVER_NAME"),
+		saslMechanism: source.get("KAFKA_SASL_MECHANISM"),
+	}
+
+	var problems ConfigProblems
+	var err error
+
+	config.saslUsername, err = source.secret("KAFKA_SASL_USERNAME")
+	problems.add(err)
+
+	config.saslPassword, err = source.secret("KAFKA_SASL_PASSWORD")
+	problems.add(err)
+
+	tlsEnabled, err := source.bool("KAFKA_TLS_ENABLED", false)
+	problems.add(err)
+	if err = problems.err(); err != nil {
+		return KafkaSecurityConfig{}, err
+	}
+
+	config.tlsEnabled = tlsEnabled || config.tlsCaFile != "" || config.tlsCertFile != "" || config.tlsServerName != ""
+
+	return config, config.validate()
+}
+
+// validate checks that certificates are readable and SASL credentials are complete.
+func (config KafkaSecurityConfig) validate() error {
+	var problems ConfigProblems
+
+	_, err := config.tlsConfig()
+	problems.add(err)
+
+	_, err = config.mechanism()
+	problems.add(err)
+
+	return problems.err()
+}
+
+// tlsConfig returns nil when TLS is disabled; system roots are used without CA file.
+func (config KafkaSecurityConfig) tlsConfig() (*tls.Config, error) {
+	if !config.tlsEnabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: config.tlsServerName,
+	}
+
+	if config.tlsCaFile != "" {
+		content, err := os.ReadFile(config.tlsCaFile)
+		if err != nil {
+			return nil, errors.New("wrong KAFKA_TLS_CA_FILE: " + err.Error())
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(content) {
+			return nil, errors.New("wrong KAFKA_TLS_CA_FILE: no PEM certificates found")
+		}
+	}
+
+	if (config.tlsCertFile == "") != (config.tlsKeyFile == "") {
+		return nil, errors.New("KAFKA_TLS_CERT_FILE and KAFKA_TLS_KEY_FILE should be set together")
+	}
+
+	if config.tlsCertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(config.tlsCertFile, config.tlsKeyFile)
+		if err != nil {
+			return nil, errors.New("wrong KAFKA_TLS_CERT_FILE or KAFKA_TLS_KEY_FILE: " + err.Error())
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+// mechanism returns nil when SASL is disabled.
+func (config KafkaSecurityConfig) mechanism() (sasl.Mechanism, error) {
+	if config.saslMechanism == "" {
+		return nil, nil
+	}
+
+	if config.saslUsername == "" || config.saslPassword == "" {
+		return nil, errors.New("KAFKA_SASL_USERNAME and KAFKA_SASL_PASSWORD are required by KAFKA_SASL_MECHANISM")
+	}
+
+	switch config.saslMechanism {
+	case SaslPlain:
+		return plain.Mechanism{Username: config.saslUsername, Password: config.saslPassword}, nil
+	case SaslScramSha256:
+		return scram.Mechanism(scram.SHA256, config.saslUsername, config.saslPassword)
+	case SaslScramSha512:
+		return scram.Mechanism(scram.SHA512, config.saslUsername, config.saslPassword)
+	}
+
+	return nil, fmt.Errorf(
+		"wrong KAFKA_SASL_MECHANISM: unknown mechanism %q, expected one of: plain, scram-sha-256, scram-sha-512",
+		config.saslMechanism,
+	)
+}
+
+func (config KafkaSecurityConfig) isEnabled() bool {
+	return config.tlsEnabled || config.saslMechanism != ""
+}
+
+func (config KafkaSecurityConfig) newDialer(timeout time.Duration) (*kafka.Dialer, error) {
+	dialer := &kafka.Dialer{
+		Timeout:   timeout,
+		DualStack: kafka.DefaultDialer.DualStack,
+	}
+
+	var err error
+	if dialer.TLS, err = config.tlsConfig(); err == nil {
+		dialer.SASLMechanism, err = config.mechanism()
+	}
+
+	return dialer, err
+}
+
+// newTransport returns nil without TLS and SASL, so writers use kafka.DefaultTransport.
+func (config KafkaSecurityConfig) newTransport(timeout time.Duration) (*kafka.Transport, error) {
+	if !config.isEnabled() {
+		return nil, nil
+	}
+
+	transport := &kafka.Transport{DialTimeout: timeout}
+
+	var err error
+	if transport.TLS, err = config.tlsConfig(); err == nil {
+		transport.SASL, err = config.mechanism()
+	}
+
+	return transport, err
+}
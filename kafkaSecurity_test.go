@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCertificate writes self-signed certificate and its key into dir.
+func writeTestCertificate(t *testing.T, dir string) (certFile string, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kafka"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	privateKey, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}), 0600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privateKey}), 0600))
+
+	return
+}
+
+func TestKafkaSecurityConfigTls(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCertificate(t, dir)
+
+	tlsConfig, err := KafkaSecurityConfig{}.tlsConfig()
+	assert.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+
+	tlsConfig, err = KafkaSecurityConfig{
+		tlsEnabled: true, tlsCaFile: certFile, tlsCertFile: certFile, tlsKeyFile: keyFile, tlsServerName: "kafka",
+	}.tlsConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "kafka", tlsConfig.ServerName)
+	assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+	assert.NotNil(t, tlsConfig.RootCAs)
+	assert.Len(t, tlsConfig.Certificates, 1)
+
+	_, err = KafkaSecurityConfig{tlsEnabled: true, tlsCaFile: keyFile}.tlsConfig()
+	assert.EqualError(t, err, "wrong KAFKA_TLS_CA_FILE: no PEM certificates found")
+
+	_, err = KafkaSecurityConfig{tlsEnabled: true, tlsCaFile: filepath.Join(dir, "not-exists.pem")}.tlsConfig()
+	assert.ErrorContains(t, err, "wrong KAFKA_TLS_CA_FILE: open ")
+
+	_, err = KafkaSecurityConfig{tlsEnabled: true, tlsCertFile: certFile}.tlsConfig()
+	assert.EqualError(t, err, "KAFKA_TLS_CERT_FILE and KAFKA_TLS_KEY_FILE should be set together")
+
+	_, err = KafkaSecurityConfig{tlsEnabled: true, tlsCertFile: keyFile, tlsKeyFile: certFile}.tlsConfig()
+	assert.ErrorContains(t, err, "wrong KAFKA_TLS_CERT_FILE or KAFKA_TLS_KEY_FILE: ")
+}
+
+func TestKafkaSecurityConfigMechanism(t *testing.T) {
+	mechanism, err := KafkaSecurityConfig{}.mechanism()
+	assert.NoError(t, err)
+	assert.Nil(t, mechanism)
+
+	mechanism, err = KafkaSecurityConfig{saslMechanism: SaslPlain, saslUsername: "user", saslPassword: "secret"}.mechanism()
+	assert.NoError(t, err)
+	assert.Equal(t, plain.Mechanism{Username: "user", Password: "secret"}, mechanism)
+
+	mechanism, err = KafkaSecurityConfig{saslMechanism: SaslScramSha256, saslUsername: "user", saslPassword: "secret"}.mechanism()
+	assert.NoError(t, err)
+	assert.Equal(t, "SCRAM-SHA-256", mechanism.Name())
+
+	mechanism, err = KafkaSecurityConfig{saslMechanism: SaslScramSha512, saslUsername: "user", saslPassword: "secret"}.mechanism()
+	assert.NoError(t, err)
+	assert.Equal(t, "SCRAM-SHA-512", mechanism.Name())
+
+	_, err = KafkaSecurityConfig{saslMechanism: SaslPlain, saslUsername: "user"}.mechanism()
+	assert.EqualError(t, err, "KAFKA_SASL_USERNAME and KAFKA_SASL_PASSWORD are required by KAFKA_SASL_MECHANISM")
+
+	_, err = KafkaSecurityConfig{saslMechanism: "gssapi", saslUsername: "user", saslPassword: "secret"}.mechanism()
+	assert.EqualError(
+		t, err, `wrong KAFKA_SASL_MECHANISM: unknown mechanism "gssapi", expected one of: plain, scram-sha-256, scram-sha-512`,
+	)
+}
+
+func TestKafkaSecurityConfigDialerAndTransport(t *testing.T) {
+	transport, err := KafkaSecurityConfig{}.newTransport(time.Second)
+	assert.NoError(t, err)
+	assert.Nil(t, transport)
+
+	dialer, err := KafkaSecurityConfig{}.newDialer(time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, dialer.Timeout)
+	assert.Nil(t, dialer.TLS)
+	assert.Nil(t, dialer.SASLMechanism)
+
+	config := KafkaSecurityConfig{tlsEnabled: true, saslMechanism: SaslPlain, saslUsername: "user", saslPassword: "secret"}
+
+	transport, err = config.newTransport(time.Second * 5)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second*5, transport.DialTimeout)
+	assert.NotNil(t, transport.TLS)
+	assert.Equal(t, plain.Mechanism{Username: "user", Password: "secret"}, transport.SASL)
+
+	dialer, err = config.newDialer(time.Second * 5)
+	assert.NoError(t, err)
+	assert.Equal(t, transport.TLS, dialer.TLS)
+	assert.Equal(t, transport.SASL, dialer.SASLMechanism)
+
+	writer := ProducerConfig{transport: transport}.newWriter([]string{"KAFKA:9999"}, "test-topic", os.Stdout)
+	assert.Same(t, transport, writer.Transport)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"time"
+)
+
+const DisciplinesImportStartedEventName = "DisciplinesImportStarted"
+const DisciplinesImportFinishedEventName = "DisciplinesImportFinished"
+
+type DisciplinesImportStartedEvent struct {
+	RunId         string
+	Year          int
+	StartDatetime time.Time
+	EndDatetime   time.Time
+	FullImport    bool
+}
+
+// DisciplinesImportFinishedEvent is published after every started import; catalog of the year is complete
+// when FullImport is finished without Error.
+type DisciplinesImportFinishedEvent struct {
+	DisciplinesImportStartedEvent
+	Sent       int
+	Skipped    int
+	Failed     int
+	Removed    int
+	Batches    BatchStats
+	DurationMs int64
+	Error      string `json:",omitempty"`
+}
+
+// ImportRun holds identity and counters of single Importer.execute call.
+type ImportRun struct {
+	Id          string
+	Task        ImportTask
+	StartedAt   time.Time
+	SourceDb    string
+	Traceparent string
+	Sent        int
+	Skipped     int
+	Failed      int
+	Removed     int
+	Batches     BatchStats
+}
+
+func newImportRun(task ImportTask, now time.Time) *ImportRun {
+	return &ImportRun{
+		Id:        newRunId(),
+		Task:      task,
+		StartedAt: now,
+	}
+}
+
+// newRunId returns random UUID v4.
+func newRunId() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
+
+func (run *ImportRun) startedEvent() DisciplinesImportStartedEvent {
+	return DisciplinesImportStartedEvent{
+		RunId:         run.Id,
+		Year:          run.Task.Year,
+		StartDatetime: run.Task.StartDatetime,
+		EndDatetime:   run.Task.EndDatetime,
+		FullImport:    run.Task.FullImport,
+	}
+}
+
+func (run *ImportRun) startedMessage() kafka.Message {
+	return run.newLifecycleMessage(DisciplinesImportStartedEventName, run.startedEvent())
+}
+
+func (run *ImportRun) finishedMessage(err error, now time.Time) kafka.Message {
+	event := DisciplinesImportFinishedEvent{
+		DisciplinesImportStartedEvent: run.startedEvent(),
+		Sent:                          run.Sent,
+		Skipped:                       run.Skipped,
+		Failed:                        run.Failed,
+		Removed:                       run.Removed,
+		Batches:                       run.Batches,
+		DurationMs:                    now.Sub(run.StartedAt).Milliseconds(),
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	return run.newLifecycleMessage(DisciplinesImportFinishedEventName, event)
+}
+
+func (run *ImportRun) newLifecycleMessage(eventName string, event any) kafka.Message {
+	payload, _ := json.Marshal(event)
+
+	return kafka.Message{
+		Key:     []byte(eventName),
+		Value:   payload,
+		Headers: run.headers(eventName, DefaultSchemaVersion),
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestNewRunId(t *testing.T) {
+	id := newRunId()
+
+	assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), id)
+	assert.NotEqual(t, id, newRunId())
+}
+
+func TestImportRunMessages(t *testing.T) {
+	startedAt := time.Date(2023, 3, 5, 4, 0, 0, 0, time.UTC)
+	task := ImportTask{
+		StartDatetime: time.Date(2023, 3, 4, 0, 0, 0, 0, time.UTC),
+		EndDatetime:   time.Date(2023, 3, 5, 0, 0, 0, 0, time.UTC),
+		Year:          2022,
+	}
+
+	run := newImportRun(task, startedAt)
+	run.Id = "run-1"
+
+	message := run.startedMessage()
+	assert.Equal(t, DisciplinesImportStartedEventName, string(message.Key))
+	assert.Equal(t, DisciplinesImportStartedEventName, messageEventName(message))
+	assert.JSONEq(
+		t,
+		`{"RunId":"run-1","Year":2022,"StartDatetime":"2023-03-04T00:00:00Z","EndDatetime":"2023-03-05T00:00:00Z","FullImport":false}`,
+		string(message.Value),
+	)
+
+	run.Sent, run.Skipped, run.Failed, run.Removed = 5, 4, 1, 2
+	message = run.finishedMessage(errors.New("expected error"), startedAt.Add(time.Second*3))
+	assert.Equal(t, DisciplinesImportFinishedEventName, string(message.Key))
+
+	var event DisciplinesImportFinishedEvent
+	assert.NoError(t, json.Unmarshal(message.Value, &event))
+	assert.Equal(t, DisciplinesImportFinishedEvent{
+		DisciplinesImportStartedEvent: run.startedEvent(),
+		Sent:                          5,
+		Skipped:                       4,
+		Failed:                        1,
+		Removed:                       2,
+		DurationMs:                    3000,
+		Error:                         "expected error",
+	}, event)
+
+	message = run.finishedMessage(nil, startedAt)
+	assert.NotContains(t, string(message.Value), "Error")
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+)
+
+// EventNameHeader carries the event type once the key no longer contains it.
+const EventNameHeader = "event"
+
+type KeyMode string
+
+const (
+	// LegacyKeyMode keeps events.DisciplineEventName as the message key for existing consumers.
+	LegacyKeyMode KeyMode = "legacy"
+	// DisciplineKeyMode keys every message by year and discipline id, so the topic can be log-compacted.
+	DisciplineKeyMode KeyMode = "discipline"
+)
+
+func parseKeyMode(value string) (KeyMode, error) {
+	switch KeyMode(value) {
+	case "", LegacyKeyMode:
+		return LegacyKeyMode, nil
+	case DisciplineKeyMode:
+		return DisciplineKeyMode, nil
+	}
+
+	return "", errors.New("unknown message key mode " + strconv.Quote(value))
+}
+
+func buildDisciplineMessageKey(mode KeyMode, eventName string, year int, id uint) []byte {
+	if mode == DisciplineKeyMode {
+		return []byte(strconv.Itoa(year) + "-" + strconv.FormatUint(uint64(id), 10))
+	}
+
+	return []byte(eventName)
+}
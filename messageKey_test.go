@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/kneu-messenger-pigeon/events"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseKeyMode(t *testing.T) {
+	t.Run("known modes", func(t *testing.T) {
+		testCases := map[string]KeyMode{
+			"":           LegacyKeyMode,
+			"legacy":     LegacyKeyMode,
+			"discipline": DisciplineKeyMode,
+		}
+
+		for value, expectedMode := range testCases {
+			mode, err := parseKeyMode(value)
+			assert.NoError(t, err)
+			assert.Equalf(t, expectedMode, mode, "Expected mode %s for %q, actual: %s", expectedMode, value, mode)
+		}
+	})
+
+	t.Run("unknown mode", func(t *testing.T) {
+		mode, err := parseKeyMode("random")
+
+		assert.Error(t, err)
+		assert.Equal(t, `unknown message key mode "random"`, err.Error())
+		assert.Empty(t, mode)
+	})
+}
+
+func TestBuildDisciplineMessageKey(t *testing.T) {
+	t.Run("legacy", func(t *testing.T) {
+		key := buildDisciplineMessageKey(LegacyKeyMode, events.DisciplineEventName, 2030, 125)
+		assert.Equal(t, events.DisciplineEventName, string(key))
+	})
+
+	t.Run("zero value is legacy", func(t *testing.T) {
+		key := buildDisciplineMessageKey("", events.DisciplineEventName, 2030, 125)
+		assert.Equal(t, events.DisciplineEventName, string(key))
+	})
+
+	t.Run("discipline", func(t *testing.T) {
+		key := buildDisciplineMessageKey(DisciplineKeyMode, events.DisciplineEventName, 2030, 125)
+		assert.Equal(t, "2030-125", string(key))
+	})
+}
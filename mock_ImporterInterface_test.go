@@ -3,7 +3,7 @@
 package main
 
 import (
-	time "time"
+	context "context"
 
 	mock "github.com/stretchr/testify/mock"
 )
@@ -13,13 +13,13 @@ type MockImporterInterface struct {
 	mock.Mock
 }
 
-// execute provides a mock function with given fields: startDatetime, endDatetime, year
-func (_m *MockImporterInterface) execute(startDatetime time.Time, endDatetime time.Time, year int) error {
-	ret := _m.Called(startDatetime, endDatetime, year)
+// execute provides a mock function with given fields: ctx, task
+func (_m *MockImporterInterface) execute(ctx context.Context, task ImportTask) error {
+	ret := _m.Called(ctx, task)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(time.Time, time.Time, int) error); ok {
-		r0 = rf(startDatetime, endDatetime, year)
+	if rf, ok := ret.Get(0).(func(context.Context, ImportTask) error); ok {
+		r0 = rf(ctx, task)
 	} else {
 		r0 = ret.Error(0)
 	}
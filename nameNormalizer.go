@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"golang.org/x/text/unicode/norm"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// UkrainianApostrophe is the modifier letter apostrophe recommended for Ukrainian orthography.
+const UkrainianApostrophe = 'ʼ'
+
+const DefaultNameNormalizers = "nfc,whitespace,apostrophe,homoglyph"
+
+// NameNormalizer is a pipeline of named steps applied to discipline name before publishing.
+type NameNormalizer []string
+
+var nameNormalizerSteps = map[string]func(string) string{
+	"nfc":        norm.NFC.String,
+	"whitespace": collapseWhitespace,
+	"apostrophe": unifyApostrophes,
+	"homoglyph":  repairHomoglyphs,
+	"capitalize": capitalizeFirstLetter,
+}
+
+var apostrophes = []rune{'\'', '’', 'ʼ', '‘', '`', '´', 'ʹ', '′'}
+
+var latinToCyrillic = map[rune]rune{
+	'A': 'А', 'B': 'В', 'C': 'С', 'E': 'Е', 'H': 'Н', 'I': 'І', 'K': 'К', 'M': 'М',
+	'O': 'О', 'P': 'Р', 'T': 'Т', 'X': 'Х',
+	'a': 'а', 'c': 'с', 'e': 'е', 'i': 'і', 'o': 'о', 'p': 'р', 'x': 'х', 'y': 'у',
+}
+
+var cyrillicToLatin = func() map[rune]rune {
+	reverse := make(map[rune]rune, len(latinToCyrillic))
+	for latin, cyrillic := range latinToCyrillic {
+		reverse[cyrillic] = latin
+	}
+	return reverse
+}()
+
+// parseNameNormalizer builds pipeline from comma separated step names; "none" disables normalization.
+func parseNameNormalizer(value string) (NameNormalizer, error) {
+	if value == "" {
+		value = DefaultNameNormalizers
+	}
+
+	normalizer := NameNormalizer{}
+	if value == "none" {
+		return normalizer, nil
+	}
+
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if _, exists := nameNormalizerSteps[name]; !exists {
+			return nil, errors.New("unknown name normalizer " + strconv.Quote(name))
+		}
+		normalizer = append(normalizer, name)
+	}
+
+	return normalizer, nil
+}
+
+func (normalizer NameNormalizer) normalize(name string) string {
+	for _, step := range normalizer {
+		name = nameNormalizerSteps[step](name)
+	}
+
+	return strings.Trim(name, " ")
+}
+
+// collapseWhitespace replaces every run of whitespace, including tabs and non-breaking spaces, with single space
+// and drops zero-width characters.
+func collapseWhitespace(name string) string {
+	var result strings.Builder
+	space := false
+	for _, char := range name {
+		switch {
+		case char == '\u200B' || char == '\u200C' || char == '\u200D' || char == '\uFEFF':
+			continue
+		case unicode.IsSpace(char):
+			space = true
+			continue
+		case space && result.Len() != 0:
+			result.WriteRune(' ')
+		}
+		space = false
+		result.WriteRune(char)
+	}
+
+	return result.String()
+}
+
+// unifyApostrophes replaces apostrophe look-alikes between two letters with UkrainianApostrophe.
+func unifyApostrophes(name string) string {
+	runes := []rune(name)
+	for i := 1; i < len(runes)-1; i++ {
+		if isApostrophe(runes[i]) && unicode.IsLetter(runes[i-1]) && unicode.IsLetter(runes[i+1]) {
+			runes[i] = UkrainianApostrophe
+		}
+	}
+
+	return string(runes)
+}
+
+func isApostrophe(char rune) bool {
+	for _, apostrophe := range apostrophes {
+		if char == apostrophe {
+			return true
+		}
+	}
+
+	return false
+}
+
+// repairHomoglyphs converts look-alike letters of minor script in each word into letters of its major script,
+// so Latin "і" in Cyrillic word becomes Cyrillic one and vice versa.
+func repairHomoglyphs(name string) string {
+	runes := []rune(name)
+	start := 0
+	for i := 0; i <= len(runes); i++ {
+		if i < len(runes) && (unicode.IsLetter(runes[i]) || isApostrophe(runes[i])) {
+			continue
+		}
+		repairWordHomoglyphs(runes[start:i])
+		start = i + 1
+	}
+
+	return string(runes)
+}
+
+func repairWordHomoglyphs(word []rune) {
+	cyrillic, latin := 0, 0
+	for _, char := range word {
+		if unicode.Is(unicode.Cyrillic, char) {
+			cyrillic++
+		} else if unicode.Is(unicode.Latin, char) {
+			latin++
+		}
+	}
+
+	if cyrillic == 0 || latin == 0 {
+		return
+	}
+
+	replacements := latinToCyrillic
+	if latin > cyrillic {
+		replacements = cyrillicToLatin
+	}
+
+	for i, char := range word {
+		if replacement, exists := replacements[char]; exists {
+			word[i] = replacement
+		}
+	}
+}
+
+func capitalizeFirstLetter(name string) string {
+	for i, char := range name {
+		if unicode.IsLetter(char) {
+			return name[:i] + string(unicode.ToUpper(char)) + name[i+len(string(char)):]
+		}
+	}
+
+	return name
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseNameNormalizer(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		normalizer, err := parseNameNormalizer("")
+		assert.NoError(t, err)
+		assert.Equal(t, NameNormalizer{"nfc", "whitespace", "apostrophe", "homoglyph"}, normalizer)
+	})
+
+	t.Run("none", func(t *testing.T) {
+		normalizer, err := parseNameNormalizer("none")
+		assert.NoError(t, err)
+		assert.Empty(t, normalizer)
+		assert.Equal(t, "Назва\t  дисципліни", normalizer.normalize("  Назва\t  дисципліни "))
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		normalizer, err := parseNameNormalizer("whitespace, capitalize")
+		assert.NoError(t, err)
+		assert.Equal(t, NameNormalizer{"whitespace", "capitalize"}, normalizer)
+		assert.Equal(t, "Назва дисципліни", normalizer.normalize(" назва\t  дисципліни "))
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		normalizer, err := parseNameNormalizer("nfc,translit")
+		assert.EqualError(t, err, `unknown name normalizer "translit"`)
+		assert.Nil(t, normalizer)
+	})
+}
+
+func TestNameNormalizerSteps(t *testing.T) {
+	t.Run("nfc", func(t *testing.T) {
+		// "й" as "и" with combining breve
+		assert.Equal(t, "Мовний", nameNormalizerSteps["nfc"]("Мовнии\u0306"))
+	})
+
+	t.Run("whitespace", func(t *testing.T) {
+		assert.Equal(t, "Основи права", collapseWhitespace("\t Основи \u00a0 права\u200b \n"))
+		assert.Equal(t, "", collapseWhitespace(" \t "))
+	})
+
+	t.Run("apostrophe", func(t *testing.T) {
+		for _, apostrophe := range []string{"'", "’", "ʼ", "‘", "`"} {
+			assert.Equal(t, "Комп"+string(UkrainianApostrophe)+"ютерні мережі", unifyApostrophes("Комп"+apostrophe+"ютерні мережі"))
+		}
+		assert.Equal(t, "'Цитата'", unifyApostrophes("'Цитата'"))
+	})
+
+	t.Run("homoglyph", func(t *testing.T) {
+		// Latin "i", "o" and "C" inside Cyrillic words
+		assert.Equal(t, "Іноземна мова (англійська) Сучасна", repairHomoglyphs("Iноземна мoва (англiйська) Cучасна"))
+		// Cyrillic "а" inside Latin word and untouched pure Latin word
+		assert.Equal(t, "Java та SQL", repairHomoglyphs("Jаva та SQL"))
+		assert.Equal(t, "Компʼютер", repairHomoglyphs("Кoмпʼютер"))
+	})
+
+	t.Run("capitalize", func(t *testing.T) {
+		assert.Equal(t, "«Економіка»", capitalizeFirstLetter("«економіка»"))
+		assert.Equal(t, "123", capitalizeFirstLetter("123"))
+	})
+
+	t.Run("default pipeline", func(t *testing.T) {
+		normalizer, _ := parseNameNormalizer("")
+		assert.Equal(
+			t, "Інформаційні технології в бізнесі та комп"+string(UkrainianApostrophe)+"ютерні мережі",
+			normalizer.normalize(" Iнформацiйнi технології  в бізнесі\tта комп’ютерні мережі "),
+		)
+	})
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kneu-messenger-pigeon/events"
+	"github.com/segmentio/kafka-go"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutboxPollInterval is how often waitDrained checks delivery of run segments.
+const OutboxPollInterval = time.Millisecond * 100
+
+const outboxSegmentExtension = ".jsonl"
+
+// OutboxRecord is kafka.Message stored in outbox segment as JSON line.
+type OutboxRecord struct {
+	Key     []byte
+	Value   []byte
+	Headers []kafka.Header
+}
+
+// Outbox is events.WriterInterface which spills batches failed to write by temporary error into append-only segment
+// files, one per batch, named by sequence and run id. While any segment is pending, new batches are spilled too,
+// so background flusher delivers messages in the original order. Segment which can not be delivered, e.g. broken one
+// or rejected by not temporary kafka error, blocks the outbox, so it fails writes and waitDrained until it is delivered.
+type Outbox struct {
+	dir      string
+	writer   events.WriterInterface
+	out      io.Writer
+	interval time.Duration
+	sequence uint64
+	// mutex serializes direct writes and spills; flusher does not take it, so spills are not blocked by delivery
+	mutex sync.Mutex
+	stop  context.CancelFunc
+	done  chan struct{}
+	// failure is set by flusher when the first segment can not be delivered, it is cleared by delivery
+	failure      error
+	failureMutex sync.Mutex
+}
+
+func NewOutbox(dir string, writer events.WriterInterface, interval time.Duration, out io.Writer) (*Outbox, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	outbox := &Outbox{
+		dir:      dir,
+		writer:   writer,
+		out:      out,
+		interval: interval,
+	}
+
+	segments, err := outbox.segments()
+	if err == nil && len(segments) != 0 {
+		outbox.sequence, _ = strconv.ParseUint(strings.SplitN(segments[len(segments)-1], "-", 2)[0], 10, 64)
+		fmt.Fprintf(out, "Outbox has %d undelivered segments \n", len(segments))
+	}
+
+	return outbox, err
+}
+
+// segments returns names of pending segment files in delivery order.
+func (outbox *Outbox) segments() ([]string, error) {
+	entries, err := os.ReadDir(outbox.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), outboxSegmentExtension) {
+			segments = append(segments, entry.Name())
+		}
+	}
+	slices.Sort(segments)
+
+	return segments, nil
+}
+
+func (outbox *Outbox) WriteMessages(ctx context.Context, messages ...kafka.Message) error {
+	outbox.mutex.Lock()
+	defer outbox.mutex.Unlock()
+
+	if err := outbox.failed(); err != nil {
+		return err
+	}
+
+	segments, err := outbox.segments()
+	if err != nil {
+		return err
+	}
+
+	if len(segments) == 0 {
+		if err = outbox.writer.WriteMessages(ctx, messages...); err == nil || !isRetryableWriteError(err) {
+			return err
+		}
+		fmt.Fprintf(outbox.out, "\nWrite failed: %v, spill %d messages to outbox\n", err, len(messages))
+	}
+
+	return outbox.spill(messages)
+}
+
+// spill writes messages into a new segment; temporary file is renamed, so flusher never reads partial segment.
+func (outbox *Outbox) spill(messages []kafka.Message) error {
+	runId := "unknown"
+	if len(messages) != 0 && messageHeader(messages[0], RunIdHeader) != "" {
+		runId = messageHeader(messages[0], RunIdHeader)
+	}
+
+	outbox.sequence++
+	filename := filepath.Join(outbox.dir, fmt.Sprintf("%020d-%s%s", outbox.sequence, runId, outboxSegmentExtension))
+
+	file, err := os.CreateTemp(outbox.dir, "segment-*.tmp")
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	for _, message := range messages {
+		if err == nil {
+			err = encoder.Encode(OutboxRecord{Key: message.Key, Value: message.Value, Headers: message.Headers})
+		}
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), filename)
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+	}
+
+	return err
+}
+
+func readOutboxSegment(filename string) ([]kafka.Message, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var messages []kafka.Message
+	decoder := json.NewDecoder(file)
+	for {
+		var record OutboxRecord
+		if err = decoder.Decode(&record); errors.Is(err, io.EOF) {
+			return messages, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("broken outbox segment %s: %w", filename, err)
+		}
+
+		messages = append(messages, kafka.Message{Key: record.Key, Value: record.Value, Headers: record.Headers})
+	}
+}
+
+// flush delivers pending segments in order and stops on the first failed one; it should not run concurrently.
+func (outbox *Outbox) flush(ctx context.Context) error {
+	segments, err := outbox.segments()
+	if err != nil {
+		return err
+	}
+
+	for _, segment := range segments {
+		filename := filepath.Join(outbox.dir, segment)
+		messages, err := readOutboxSegment(filename)
+		if err != nil {
+			outbox.setFailure(err)
+			return err
+		}
+
+		if err = outbox.writer.WriteMessages(ctx, messages...); err != nil {
+			if ctx.Err() == nil && !isRetryableWriteError(err) {
+				err = fmt.Errorf("outbox segment %s can not be delivered: %w", segment, err)
+				outbox.setFailure(err)
+			}
+			return err
+		}
+
+		if err = os.Remove(filename); err != nil {
+			return err
+		}
+		outbox.setFailure(nil)
+	}
+
+	return nil
+}
+
+func (outbox *Outbox) setFailure(err error) {
+	outbox.failureMutex.Lock()
+	defer outbox.failureMutex.Unlock()
+
+	outbox.failure = err
+}
+
+func (outbox *Outbox) failed() error {
+	outbox.failureMutex.Lock()
+	defer outbox.failureMutex.Unlock()
+
+	return outbox.failure
+}
+
+// start runs background flusher until Close.
+func (outbox *Outbox) start() {
+	var ctx context.Context
+	ctx, outbox.stop = context.WithCancel(context.Background())
+	outbox.done = make(chan struct{})
+
+	go func() {
+		defer close(outbox.done)
+		ticker := time.NewTicker(outbox.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := outbox.flush(ctx); err != nil && ctx.Err() == nil {
+				fmt.Fprintf(outbox.out, "\nOutbox flush failed: %v\n", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// waitDrained blocks until all segments of the run are delivered, it fails when outbox is blocked by failed segment.
+func (outbox *Outbox) waitDrained(ctx context.Context, runId string) error {
+	for {
+		if err := outbox.failed(); err != nil {
+			return err
+		}
+
+		segments, err := outbox.segments()
+		if err != nil {
+			return err
+		}
+
+		if !slices.ContainsFunc(segments, func(segment string) bool {
+			return strings.HasSuffix(segment, "-"+runId+outboxSegmentExtension)
+		}) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(OutboxPollInterval):
+		}
+	}
+}
+
+func (outbox *Outbox) Close() error {
+	if outbox.stop != nil {
+		outbox.stop()
+		<-outbox.done
+	}
+
+	return outbox.writer.Close()
+}
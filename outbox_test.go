@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/kneu-messenger-pigeon/events/mocks"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOutbox(t *testing.T) {
+	matchContext := mock.MatchedBy(func(ctx context.Context) bool { return true })
+	expectedError := errors.New("kafka is unavailable")
+
+	runHeaders := []kafka.Header{{Key: EventNameHeader, Value: []byte("DisciplineEvent")}, {Key: RunIdHeader, Value: []byte("run-1")}}
+	first := kafka.Message{Key: []byte("2030-10"), Value: []byte(`{"Id":10}`), Headers: runHeaders}
+	second := kafka.Message{Key: []byte("2030-11"), Value: []byte(`{"Id":11}`), Headers: runHeaders}
+	third := kafka.Message{Key: []byte("2030-12"), Value: []byte(`{"Id":12}`), Headers: runHeaders}
+
+	t.Run("write directly", func(t *testing.T) {
+		writer := mocks.NewWriterInterface(t)
+		writer.On("WriteMessages", matchContext, first, second).Return(nil).Once()
+
+		outbox, err := NewOutbox(t.TempDir(), writer, time.Second, io.Discard)
+		assert.NoError(t, err)
+		assert.NoError(t, outbox.WriteMessages(context.Background(), first, second))
+
+		segments, _ := outbox.segments()
+		assert.Empty(t, segments)
+	})
+
+	t.Run("spill and flush in order", func(t *testing.T) {
+		var out bytes.Buffer
+		dir := t.TempDir()
+
+		writer := mocks.NewWriterInterface(t)
+		writer.On("WriteMessages", matchContext, first).Return(expectedError).Once()
+
+		outbox, err := NewOutbox(dir, writer, time.Second, &out)
+		assert.NoError(t, err)
+
+		// the second batch is spilled without write attempt while the first one is pending
+		assert.NoError(t, outbox.WriteMessages(context.Background(), first))
+		assert.NoError(t, outbox.WriteMessages(context.Background(), second, third))
+		assert.Contains(t, out.String(), "Write failed: kafka is unavailable, spill 1 messages to outbox")
+
+		segments, _ := outbox.segments()
+		assert.Equal(t, []string{"00000000000000000001-run-1.jsonl", "00000000000000000002-run-1.jsonl"}, segments)
+
+		writer.On("WriteMessages", matchContext, first).Return(nil).Once()
+		writer.On("WriteMessages", matchContext, second, third).Return(expectedError).Once()
+		assert.Equal(t, expectedError, outbox.flush(context.Background()))
+
+		segments, _ = outbox.segments()
+		assert.Equal(t, []string{"00000000000000000002-run-1.jsonl"}, segments)
+
+		writer.On("WriteMessages", matchContext, second, third).Return(nil).Once()
+		assert.NoError(t, outbox.flush(context.Background()))
+
+		segments, _ = outbox.segments()
+		assert.Empty(t, segments)
+		writer.AssertExpectations(t)
+	})
+
+	t.Run("continue sequence of existing segments", func(t *testing.T) {
+		var out bytes.Buffer
+		dir := t.TempDir()
+		_ = os.WriteFile(filepath.Join(dir, "00000000000000000007-run-0.jsonl"), []byte{}, 0644)
+
+		writer := mocks.NewWriterInterface(t)
+
+		outbox, err := NewOutbox(dir, writer, time.Second, &out)
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), "Outbox has 1 undelivered segments")
+
+		assert.NoError(t, outbox.WriteMessages(context.Background(), first))
+
+		segments, _ := outbox.segments()
+		assert.Equal(t, []string{"00000000000000000007-run-0.jsonl", "00000000000000000008-run-1.jsonl"}, segments)
+		writer.AssertNotCalled(t, "WriteMessages")
+	})
+
+	t.Run("broken segment", func(t *testing.T) {
+		dir := t.TempDir()
+		_ = os.WriteFile(filepath.Join(dir, "00000000000000000001-run-1.jsonl"), []byte("{broken"), 0644)
+
+		outbox, err := NewOutbox(dir, mocks.NewWriterInterface(t), time.Second, io.Discard)
+		assert.NoError(t, err)
+		assert.ErrorContains(t, outbox.flush(context.Background()), "broken outbox segment")
+		assert.ErrorContains(t, outbox.waitDrained(context.Background(), "run-1"), "broken outbox segment")
+	})
+
+	t.Run("not temporary write error is not spilled", func(t *testing.T) {
+		writer := mocks.NewWriterInterface(t)
+		writer.On("WriteMessages", matchContext, first).Return(kafka.MessageSizeTooLarge).Once()
+
+		outbox, err := NewOutbox(t.TempDir(), writer, time.Second, io.Discard)
+		assert.NoError(t, err)
+		assert.ErrorIs(t, outbox.WriteMessages(context.Background(), first), kafka.MessageSizeTooLarge)
+
+		segments, _ := outbox.segments()
+		assert.Empty(t, segments)
+	})
+
+	t.Run("not deliverable segment fails writes and wait drained", func(t *testing.T) {
+		writer := mocks.NewWriterInterface(t)
+		writer.On("WriteMessages", matchContext, first).Return(expectedError).Once()
+		writer.On("WriteMessages", matchContext, first).Return(kafka.TopicAuthorizationFailed).Once()
+
+		outbox, err := NewOutbox(t.TempDir(), writer, time.Second, io.Discard)
+		assert.NoError(t, err)
+		assert.NoError(t, outbox.WriteMessages(context.Background(), first))
+		assert.ErrorIs(t, outbox.flush(context.Background()), kafka.TopicAuthorizationFailed)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		err = outbox.waitDrained(ctx, "run-1")
+		assert.ErrorIs(t, err, kafka.TopicAuthorizationFailed)
+		assert.ErrorContains(t, err, "outbox segment 00000000000000000001-run-1.jsonl can not be delivered")
+		assert.ErrorIs(t, outbox.WriteMessages(context.Background(), second), kafka.TopicAuthorizationFailed)
+
+		// delivery of segment unblocks outbox
+		writer.On("WriteMessages", matchContext, first).Return(nil).Once()
+		writer.On("WriteMessages", matchContext, second).Return(nil).Once()
+		assert.NoError(t, outbox.flush(context.Background()))
+		assert.NoError(t, outbox.waitDrained(ctx, "run-1"))
+		assert.NoError(t, outbox.WriteMessages(context.Background(), second))
+	})
+
+	t.Run("background flush and wait drained", func(t *testing.T) {
+		writer := mocks.NewWriterInterface(t)
+		writer.On("WriteMessages", matchContext, first).Return(expectedError).Once()
+		writer.On("WriteMessages", matchContext, first).Return(nil).Once()
+		writer.On("Close").Return(nil).Once()
+
+		outbox, err := NewOutbox(t.TempDir(), writer, time.Millisecond*10, io.Discard)
+		assert.NoError(t, err)
+		assert.NoError(t, outbox.WriteMessages(context.Background(), first))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		outbox.start()
+		assert.NoError(t, outbox.waitDrained(ctx, "run-1"))
+		assert.NoError(t, outbox.Close())
+		writer.AssertExpectations(t)
+	})
+
+	t.Run("wait drained is cancelled", func(t *testing.T) {
+		writer := mocks.NewWriterInterface(t)
+		writer.On("WriteMessages", matchContext, first).Return(expectedError).Once()
+
+		outbox, err := NewOutbox(t.TempDir(), writer, time.Second, io.Discard)
+		assert.NoError(t, err)
+		assert.NoError(t, outbox.WriteMessages(context.Background(), first))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+		defer cancel()
+
+		assert.NoError(t, outbox.waitDrained(ctx, "run-2"))
+		assert.ErrorIs(t, outbox.waitDrained(ctx, "run-1"), context.DeadlineExceeded)
+	})
+
+	t.Run("not writable dir", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "file")
+		_ = os.WriteFile(file, []byte{}, 0644)
+
+		_, err := NewOutbox(filepath.Join(file, "outbox"), mocks.NewWriterInterface(t), time.Second, io.Discard)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	LeastBytesBalancer = "least-bytes"
+	RoundRobinBalancer = "round-robin"
+	HashBalancer       = "hash"
+	Crc32Balancer      = "crc32"
+	Murmur2Balancer    = "murmur2"
+)
+
+var balancers = []string{LeastBytesBalancer, RoundRobinBalancer, HashBalancer, Crc32Balancer, Murmur2Balancer}
+
+// ProducerConfig describes kafka.Writer settings shared by every Kafka producer of the app.
+// kafka-go has no idempotent producer: retried writes may publish duplicates, which consumers are able to drop
+// only with key hash balancer and discipline key mode, see Config.warnings.
+type ProducerConfig struct {
+	compression  kafka.Compression
+	requiredAcks kafka.RequiredAcks
+	// async writes return without waiting for brokers, failures are only logged by completion callback
+	async        bool
+	writeTimeout time.Duration
+	batchTimeout time.Duration
+	balancer     string
+	// transport carries TLS and SASL settings, nil means kafka.DefaultTransport
+	transport *kafka.Transport
+}
+
+func loadProducerConfig(source *ConfigSource, keyMode KeyMode) (ProducerConfig, error) {
+	var problems ConfigProblems
+	var err error
+
+	// compacted topic keeps the latest version of a key only within one partition
+	defaultBalancer := LeastBytesBalancer
+	if keyMode == DisciplineKeyMode {
+		defaultBalancer = HashBalancer
+	}
+
+	// platform requires acks=all and zstd compression for all producers
+	config := ProducerConfig{
+		compression:  kafka.Zstd,
+		requiredAcks: kafka.RequireAll,
+		balancer:     source.getOrDefault("KAFKA_PRODUCER_BALANCER", defaultBalancer),
+	}
+
+	if value := source.get("KAFKA_PRODUCER_COMPRESSION"); value != "" {
+		if err = config.compression.UnmarshalText([]byte(value)); err != nil {
+			problems.add(fmt.Errorf(
+				"wrong KAFKA_PRODUCER_COMPRESSION: unknown codec %q, expected one of: none, gzip, snappy, lz4, zstd", value,
+			))
+		}
+	}
+
+	if value := source.get("KAFKA_PRODUCER_ACKS"); value != "" {
+		if err = config.requiredAcks.UnmarshalText([]byte(value)); err != nil {
+			problems.add(fmt.Errorf("wrong KAFKA_PRODUCER_ACKS: unknown value %q, expected one of: none, one, all", value))
+		}
+	}
+
+	config.async, err = source.bool("KAFKA_PRODUCER_ASYNC", false)
+	problems.add(err)
+
+	config.writeTimeout, err = source.duration("KAFKA_PRODUCER_WRITE_TIMEOUT", time.Second*10)
+	problems.add(err)
+
+	config.batchTimeout, err = source.duration("KAFKA_PRODUCER_BATCH_TIMEOUT", time.Second)
+	problems.add(err)
+
+	problems.add(config.validate())
+
+	if keyMode == DisciplineKeyMode && (config.balancer == LeastBytesBalancer || config.balancer == RoundRobinBalancer) {
+		problems.add(fmt.Errorf(
+			"KAFKA_PRODUCER_BALANCER=%s can not be used with DISCIPLINES_KEY_MODE=discipline: versions and tombstones "+
+				"of a discipline should land into one partition of compacted topic, use hash, crc32 or murmur2", config.balancer,
+		))
+	}
+
+	return config, problems.err()
+}
+
+func (config ProducerConfig) validate() error {
+	var problems ConfigProblems
+	if !slices.Contains(balancers, config.balancer) {
+		problems.add(fmt.Errorf(
+			"wrong KAFKA_PRODUCER_BALANCER: unknown balancer %q, expected one of: %s",
+			config.balancer, strings.Join(balancers, ", "),
+		))
+	}
+
+	if config.writeTimeout == 0 {
+		problems.add(errors.New("wrong KAFKA_PRODUCER_WRITE_TIMEOUT: should be positive"))
+	}
+
+	if config.batchTimeout == 0 {
+		problems.add(errors.New("wrong KAFKA_PRODUCER_BATCH_TIMEOUT: should be positive"))
+	}
+
+	return problems.err()
+}
+
+// keepsKeyPartition reports whether balancer sends all messages of a key into the same partition.
+func (config ProducerConfig) keepsKeyPartition() bool {
+	return config.balancer == HashBalancer || config.balancer == Crc32Balancer || config.balancer == Murmur2Balancer
+}
+
+func (config ProducerConfig) newBalancer() kafka.Balancer {
+	switch config.balancer {
+	case RoundRobinBalancer:
+		return &kafka.RoundRobin{}
+	case HashBalancer:
+		return &kafka.Hash{}
+	case Crc32Balancer:
+		return &kafka.CRC32Balancer{}
+	case Murmur2Balancer:
+		return &kafka.Murmur2Balancer{}
+	}
+
+	return &kafka.LeastBytes{}
+}
+
+// newWriter creates kafka.Writer for topic; in async mode failed deliveries are logged into out.
+func (config ProducerConfig) newWriter(kafkaBrokers []string, topic string, out io.Writer) *kafka.Writer {
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(kafkaBrokers...),
+		Topic:        topic,
+		Balancer:     config.newBalancer(),
+		Compression:  config.compression,
+		RequiredAcks: config.requiredAcks,
+		Async:        config.async,
+		WriteTimeout: config.writeTimeout,
+		BatchTimeout: config.batchTimeout,
+	}
+
+	if config.transport != nil {
+		writer.Transport = config.transport
+	}
+
+	if config.async {
+		writer.Completion = func(messages []kafka.Message, err error) {
+			if err != nil {
+				fmt.Fprintf(out, "\nAsync write of %d messages to %s failed: %v\n", len(messages), topic, err)
+			}
+		}
+	}
+
+	return writer
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestProducerConfigValidate(t *testing.T) {
+	valid := ProducerConfig{writeTimeout: time.Second, batchTimeout: time.Second, balancer: LeastBytesBalancer}
+	assert.NoError(t, valid.validate())
+
+	config := valid
+	config.writeTimeout = 0
+	assert.EqualError(t, config.validate(), "wrong KAFKA_PRODUCER_WRITE_TIMEOUT: should be positive")
+
+	config = valid
+	config.batchTimeout = 0
+	assert.EqualError(t, config.validate(), "wrong KAFKA_PRODUCER_BATCH_TIMEOUT: should be positive")
+}
+
+func TestProducerConfigNewBalancer(t *testing.T) {
+	expectedBalancers := map[string]kafka.Balancer{
+		LeastBytesBalancer: &kafka.LeastBytes{},
+		RoundRobinBalancer: &kafka.RoundRobin{},
+		HashBalancer:       &kafka.Hash{},
+		Crc32Balancer:      &kafka.CRC32Balancer{},
+		Murmur2Balancer:    &kafka.Murmur2Balancer{},
+	}
+
+	for balancer, expected := range expectedBalancers {
+		assert.IsType(t, expected, ProducerConfig{balancer: balancer}.newBalancer(), balancer)
+	}
+}
+
+func TestProducerConfigNewWriter(t *testing.T) {
+	var out bytes.Buffer
+
+	config := ProducerConfig{
+		compression:  kafka.Zstd,
+		requiredAcks: kafka.RequireAll,
+		writeTimeout: time.Second * 30,
+		batchTimeout: time.Millisecond * 50,
+		balancer:     HashBalancer,
+	}
+
+	writer := config.newWriter([]string{"KAFKA-1:9999", "KAFKA-2:9999"}, "test-topic", &out)
+	assert.Equal(t, kafka.TCP("KAFKA-1:9999", "KAFKA-2:9999"), writer.Addr)
+	assert.Equal(t, "test-topic", writer.Topic)
+	assert.IsType(t, &kafka.Hash{}, writer.Balancer)
+	assert.Equal(t, kafka.Zstd, writer.Compression)
+	assert.Equal(t, kafka.RequireAll, writer.RequiredAcks)
+	assert.Equal(t, time.Second*30, writer.WriteTimeout)
+	assert.Equal(t, time.Millisecond*50, writer.BatchTimeout)
+	assert.False(t, writer.Async)
+	assert.Nil(t, writer.Completion)
+
+	config.async = true
+	writer = config.newWriter([]string{"KAFKA-1:9999", "KAFKA-2:9999"}, "test-topic", &out)
+	assert.True(t, writer.Async)
+
+	writer.Completion(make([]kafka.Message, 2), nil)
+	assert.Empty(t, out.String())
+
+	writer.Completion(make([]kafka.Message, 2), errors.New("dummy error"))
+	assert.Equal(t, "\nAsync write of 2 messages to test-topic failed: dummy error\n", out.String())
+}
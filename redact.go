@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// RedactedValue replaces secrets in printed config and errors.
+const RedactedValue = "*****"
+
+var passwordOptionRegexp = regexp.MustCompile(`(?i)\b(password|pwd)=('[^']*'|[^\s;&]*)`)
+
+// redactDsn hides password of URL, key=value and user:password@host DSN.
+func redactDsn(dsn string) string {
+	if parsed, err := url.Parse(dsn); err == nil && parsed.Scheme != "" && parsed.Host != "" {
+		parsed.RawQuery = passwordOptionRegexp.ReplaceAllString(parsed.RawQuery, "${1}="+RedactedValue)
+
+		// url.Redacted replaces password by "xxxxx"
+		return strings.Replace(parsed.Redacted(), ":xxxxx@", ":"+RedactedValue+"@", 1)
+	}
+
+	dsn = passwordOptionRegexp.ReplaceAllString(dsn, "${1}="+RedactedValue)
+	if i := strings.LastIndex(dsn, "@"); i >= 0 {
+		start := userInfoStart(dsn[:i])
+		if user, _, hasPassword := strings.Cut(dsn[start:i], ":"); hasPassword {
+			return dsn[:start] + user + ":" + RedactedValue + dsn[i:]
+		}
+	}
+
+	return dsn
+}
+
+// redactUrl hides password and whole query of URL, as webhook tokens are usually passed in query.
+func redactUrl(rawUrl string) string {
+	redacted := redactDsn(rawUrl)
+	if withoutQuery, _, hasQuery := strings.Cut(redacted, "?"); hasQuery {
+		return withoutQuery + "?" + RedactedValue
+	}
+
+	return redacted
+}
+
+// userInfoStart skips scheme of URL which can not be parsed, e.g. because of wrong port.
+func userInfoStart(dsn string) int {
+	if i := strings.Index(dsn, "://"); i >= 0 {
+		return i + len("://")
+	}
+
+	return 0
+}
+
+// redactSecret keeps only whether secret is set.
+func redactSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+
+	return RedactedValue
+}
+
+// dsnPasswords extracts passwords of DSN in formats supported by redactDsn.
+func dsnPasswords(dsn string) []string {
+	var passwords []string
+	if parsed, err := url.Parse(dsn); err == nil && parsed.Scheme != "" && parsed.Host != "" {
+		if password, hasPassword := parsed.User.Password(); hasPassword {
+			passwords = append(passwords, password)
+		}
+		dsn = parsed.RawQuery
+	} else if i := strings.LastIndex(dsn, "@"); i >= 0 {
+		if _, password, hasPassword := strings.Cut(dsn[userInfoStart(dsn[:i]):i], ":"); hasPassword {
+			passwords = append(passwords, password)
+		}
+	}
+
+	for _, match := range passwordOptionRegexp.FindAllStringSubmatch(dsn, -1) {
+		passwords = append(passwords, strings.Trim(match[2], "'"))
+	}
+
+	return passwords
+}
+
+// secretsReplacer replaces every secret of config by RedactedValue, DSN and webhook URL keep their not secret parts.
+func (config Config) secretsReplacer() *strings.Replacer {
+	var pairs []string
+	add := func(secret string, replacement string) {
+		if secret != "" && secret != replacement {
+			pairs = append(pairs, secret, replacement)
+		}
+	}
+
+	// whole values go first, as replacer matches arguments in order
+	add(config.secondaryDekanatDbDSN, redactDsn(config.secondaryDekanatDbDSN))
+	secrets := dsnPasswords(config.secondaryDekanatDbDSN)
+	for _, sink := range config.sinks {
+		add(sink.webhookUrl, redactUrl(sink.webhookUrl))
+		secrets = append(append(secrets, dsnPasswords(sink.webhookUrl)...), sink.webhookAuthorization)
+		if _, query, hasQuery := strings.Cut(sink.webhookUrl, "?"); hasQuery {
+			secrets = append(secrets, query)
+		}
+	}
+	secrets = append(secrets, config.dbConnection.password, config.kafkaSecurity.saslPassword)
+
+	// drivers may quote escaped secret of DSN
+	for _, secret := range secrets {
+		add(secret, RedactedValue)
+		add(url.QueryEscape(secret), RedactedValue)
+		add(url.PathEscape(secret), RedactedValue)
+	}
+
+	return strings.NewReplacer(pairs...)
+}
+
+// RedactingWriter hides secrets in logs; every write is redacted separately, so log lines should be written at once.
+type RedactingWriter struct {
+	out      io.Writer
+	replacer *strings.Replacer
+}
+
+func (writer *RedactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(writer.out, writer.replacer.Replace(string(p))); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// redactError hides secrets in error message, error without secrets is returned as is.
+func redactError(err error, replacer *strings.Replacer) error {
+	if err == nil {
+		return nil
+	}
+
+	if message := replacer.Replace(err.Error()); message != err.Error() {
+		return errors.New(message)
+	}
+
+	return err
+}
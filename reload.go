@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// reloadableSettings are read by importer on every import, so they are changed by reload without restart.
+// Kafka writers keep batch size they were created with, so BATCH_* settings change only batches of importer.
+var reloadableSettings = []string{
+	"DISCIPLINES_NAME_NORMALIZERS",
+	"DISCIPLINES_KEEP_RAW_NAME",
+	"FORCE_IMPORT",
+	"DEAD_LETTER_MAX_ROWS",
+	"TRACING_ENABLED",
+	"BATCH_MAX_MESSAGES",
+	"BATCH_MAX_BYTES",
+	"BATCH_LINGER",
+}
+
+// ConfigReloader reads CONFIG_FILE again and applies changed reloadable settings to importer.
+// Not empty env variables override config file, so settings set by them are not changed by reload.
+type ConfigReloader struct {
+	out      io.Writer
+	config   Config
+	importer *Importer
+}
+
+// reload rejects whole config when it is invalid or changes settings which require restart.
+func (reloader *ConfigReloader) reload() {
+	changes, err := reloader.apply()
+	if err != nil {
+		fmt.Fprintf(reloader.out, "Config reload rejected: %s\n", redactError(err, reloader.config.secretsReplacer()))
+	} else if len(changes) == 0 {
+		fmt.Fprintln(reloader.out, "Config reloaded without changes")
+	} else {
+		fmt.Fprintf(reloader.out, "Config reloaded: %s\n", strings.Join(changes, ", "))
+	}
+}
+
+func (reloader *ConfigReloader) apply() ([]string, error) {
+	source, err := NewConfigSource(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		return nil, errors.New("wrong CONFIG_FILE: " + err.Error())
+	}
+
+	config, err := loadConfigFromSource(source)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, restartRequired := diffSettings(reloader.config.settings(), config.settings())
+	// secrets are redacted in settings, so their changes are compared separately
+	if !slices.Equal(reloader.config.secretValues(), config.secretValues()) {
+		restartRequired = append(restartRequired, "credentials")
+	}
+	if len(restartRequired) != 0 {
+		return nil, fmt.Errorf("%s can not be changed without restart", strings.Join(restartRequired, ", "))
+	}
+
+	reloader.importer.normalizer = config.nameNormalizer
+	reloader.importer.keepRawName = config.keepRawName
+	reloader.importer.force = config.forceImport
+	reloader.importer.maxInvalidRows = config.maxInvalidRows
+	reloader.importer.tracing = config.tracing
+	reloader.importer.batch = config.batch
+	reloader.config = config
+
+	return changes, nil
+}
+
+// diffSettings describes changes of reloadable settings and lists names of other changed settings.
+func diffSettings(previous [][2]string, next [][2]string) (changes []string, restartRequired []string) {
+	values := map[string]string{}
+	for _, setting := range previous {
+		values[setting[0]] = setting[1]
+	}
+
+	// sinks may be added or removed, so their settings are compared by names of both configs
+	names := map[string]bool{}
+	for _, setting := range next {
+		names[setting[0]] = true
+		previousValue, exists := values[setting[0]]
+		switch {
+		case exists && previousValue == setting[1]:
+		case exists && slices.Contains(reloadableSettings, setting[0]):
+			changes = append(changes, fmt.Sprintf("%s %q -> %q", setting[0], previousValue, setting[1]))
+		default:
+			restartRequired = append(restartRequired, setting[0])
+		}
+	}
+
+	for _, setting := range previous {
+		if !names[setting[0]] {
+			restartRequired = append(restartRequired, setting[0])
+		}
+	}
+
+	return
+}
+
+// secretValues lists secrets which are redacted in settings.
+func (config Config) secretValues() []string {
+	values := []string{config.secondaryDekanatDbDSN, config.dbConnection.password, config.kafkaSecurity.saslPassword}
+	for _, sink := range config.sinks {
+		values = append(values, sink.webhookUrl, sink.webhookAuthorization)
+	}
+
+	return values
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigReloader(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(content string) {
+		content = "kafka: {host: kafka:9092}\nsecondary_dekanat_db_dsn: USER:PASSWORD@HOST/DATABASE\n" + content
+		_ = os.WriteFile(configFile, []byte(content), 0600)
+	}
+
+	writeConfig("batch: {max_messages: 100}\ndisciplines: {name_normalizers: nfc}\n")
+	_ = os.Setenv("CONFIG_FILE", configFile)
+	_ = os.Setenv("KAFKA_HOST", "")
+	_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "")
+	defer os.Unsetenv("CONFIG_FILE")
+
+	config, err := loadConfig("")
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	importer := &Importer{batch: config.batch, normalizer: config.nameNormalizer}
+	reloader := &ConfigReloader{out: &out, config: config, importer: importer}
+
+	t.Run("reloadable settings are applied", func(t *testing.T) {
+		out.Reset()
+		writeConfig("batch: {max_messages: 500}\ndisciplines: {name_normalizers: [nfc, capitalize]}\n")
+
+		reloader.reload()
+
+		assert.Equal(
+			t, "Config reloaded: DISCIPLINES_NAME_NORMALIZERS \"nfc\" -> \"nfc,capitalize\", "+
+				"BATCH_MAX_MESSAGES \"100\" -> \"500\"\n",
+			out.String(),
+		)
+		assert.Equal(t, 500, importer.batch.maxCount)
+		assert.Equal(t, NameNormalizer{"nfc", "capitalize"}, importer.normalizer)
+
+		out.Reset()
+		reloader.reload()
+		assert.Equal(t, "Config reloaded without changes\n", out.String())
+	})
+
+	t.Run("settings which require restart are rejected", func(t *testing.T) {
+		out.Reset()
+		writeConfig("batch: {max_messages: 10}\ndisciplines: {name_normalizers: [nfc, capitalize]}\nkafka_timeout: 30s\n")
+
+		reloader.reload()
+
+		assert.Equal(t, "Config reload rejected: KAFKA_TIMEOUT can not be changed without restart\n", out.String())
+		assert.Equal(t, 500, importer.batch.maxCount)
+	})
+
+	t.Run("enrichment requires restart", func(t *testing.T) {
+		out.Reset()
+		writeConfig("batch: {max_messages: 500}\ndisciplines: {name_normalizers: [nfc, capitalize], " +
+			"enrichment: {joins: LEFT JOIN T_KAF ON T_KAF.ID = T_PD_CMS.KAF_ID}}\n")
+
+		reloader.reload()
+
+		assert.Equal(t, "Config reload rejected: DISCIPLINES_ENRICHMENT_JOINS can not be changed without restart\n", out.String())
+	})
+
+	t.Run("credentials require restart", func(t *testing.T) {
+		out.Reset()
+		_ = os.WriteFile(configFile, []byte("kafka: {host: kafka:9092}\nsecondary_dekanat_db_dsn: USER:CHANGED@HOST/DATABASE\n"+
+			"batch: {max_messages: 500}\ndisciplines: {name_normalizers: [nfc, capitalize]}\n"), 0600)
+
+		reloader.reload()
+
+		assert.Equal(t, "Config reload rejected: credentials can not be changed without restart\n", out.String())
+	})
+
+	t.Run("invalid config is rejected", func(t *testing.T) {
+		out.Reset()
+		writeConfig("batch: {max_messages: 0}\ndisciplines: {name_normalizers: [nfc, unknown]}\n")
+
+		reloader.reload()
+
+		assert.Equal(
+			t, "Config reload rejected: 2 problems:"+
+				"\n  - wrong BATCH_MAX_MESSAGES: expected positive number, got \"0\""+
+				"\n  - wrong DISCIPLINES_NAME_NORMALIZERS: unknown name normalizer \"unknown\"\n",
+			out.String(),
+		)
+		assert.Equal(t, 500, importer.batch.maxCount)
+	})
+}
+
+func TestDiffSettings(t *testing.T) {
+	changes, restartRequired := diffSettings(
+		[][2]string{{"BATCH_LINGER", "0s"}, {"KAFKA_TIMEOUT", "10s"}, {"OUTPUT_FILE", "out.jsonl"}},
+		[][2]string{{"BATCH_LINGER", "1s"}, {"KAFKA_TIMEOUT", "10s"}, {"OUTPUT_WEBHOOK_URL", "https://example.com"}},
+	)
+
+	assert.Equal(t, []string{`BATCH_LINGER "0s" -> "1s"`}, changes)
+	assert.Equal(t, []string{"OUTPUT_WEBHOOK_URL", "OUTPUT_FILE"}, restartRequired)
+}
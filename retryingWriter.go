@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kneu-messenger-pigeon/events"
+	"github.com/segmentio/kafka-go"
+	"io"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy describes exponential backoff of failed writes; zero maxDuration disables retries.
+type RetryPolicy struct {
+	initialDelay time.Duration
+	maxDelay     time.Duration
+	maxDuration  time.Duration
+}
+
+// delay returns backoff before retry after attempt with jitter: random value in [delay/2, delay).
+func (policy RetryPolicy) delay(attempt int) time.Duration {
+	delay := policy.initialDelay
+	for i := 1; i < attempt && delay < policy.maxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, policy.maxDelay)
+
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// RetryingWriter is events.WriterInterface which retries failed writes until RetryPolicy.maxDuration is spent.
+// When writer returns kafka.WriteErrors, only failed messages are retried.
+type RetryingWriter struct {
+	writer events.WriterInterface
+	policy RetryPolicy
+	out    io.Writer
+}
+
+func NewRetryingWriter(writer events.WriterInterface, policy RetryPolicy, out io.Writer) *RetryingWriter {
+	return &RetryingWriter{writer: writer, policy: policy, out: out}
+}
+
+// withRetries wraps writer into RetryingWriter unless retries are disabled by policy.
+func withRetries(writer events.WriterInterface, policy RetryPolicy, out io.Writer) events.WriterInterface {
+	if policy.maxDuration == 0 {
+		return writer
+	}
+
+	return NewRetryingWriter(writer, policy, out)
+}
+
+func (writer *RetryingWriter) WriteMessages(ctx context.Context, messages ...kafka.Message) error {
+	deadline := time.Now().Add(writer.policy.maxDuration)
+	for attempt := 1; ; attempt++ {
+		err := writer.writer.WriteMessages(ctx, messages...)
+		if err == nil {
+			return nil
+		}
+
+		var writeErrors kafka.WriteErrors
+		if errors.As(err, &writeErrors) && len(writeErrors) == len(messages) {
+			failed := make([]kafka.Message, 0, writeErrors.Count())
+			for i, writeError := range writeErrors {
+				if writeError != nil {
+					failed = append(failed, messages[i])
+				}
+			}
+			messages = failed
+		}
+
+		delay := writer.policy.delay(attempt)
+		if !isRetryableWriteError(err) || time.Now().Add(delay).After(deadline) {
+			if attempt > 1 {
+				err = fmt.Errorf("write failed after %d attempts: %w", attempt, err)
+			}
+			return err
+		}
+
+		fmt.Fprintf(
+			writer.out, "\nWrite of %d messages failed (attempt %d): %v, retry in %s\n",
+			len(messages), attempt, err, delay.Round(time.Millisecond),
+		)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (writer *RetryingWriter) Close() error {
+	return writer.writer.Close()
+}
+
+// isRetryableWriteError treats network errors as temporary; kafka errors are retried only when they are temporary.
+// Message exceeding writer BatchBytes and closed writer fail on client side the same way on every attempt.
+func isRetryableWriteError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrClosedPipe) {
+		return false
+	}
+
+	var tooLargeError kafka.MessageTooLargeError
+	if errors.As(err, &tooLargeError) {
+		return false
+	}
+
+	var writeErrors kafka.WriteErrors
+	if errors.As(err, &writeErrors) {
+		for _, writeError := range writeErrors {
+			if writeError != nil && !isRetryableWriteError(writeError) {
+				return false
+			}
+		}
+
+		return writeErrors.Count() != 0
+	}
+
+	var kafkaError kafka.Error
+	if errors.As(err, &kafkaError) {
+		return kafkaError.Temporary()
+	}
+
+	return true
+}
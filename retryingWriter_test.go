@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kneu-messenger-pigeon/events/mocks"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{initialDelay: time.Millisecond * 100, maxDelay: time.Second}
+
+	for attempt, expectedMax := range map[int]time.Duration{
+		1:  time.Millisecond * 100,
+		2:  time.Millisecond * 200,
+		3:  time.Millisecond * 400,
+		4:  time.Millisecond * 800,
+		5:  time.Second,
+		20: time.Second,
+	} {
+		delay := policy.delay(attempt)
+		assert.GreaterOrEqual(t, delay, expectedMax/2, attempt)
+		assert.LessOrEqual(t, delay, expectedMax, attempt)
+	}
+}
+
+func TestRetryingWriter(t *testing.T) {
+	matchContext := mock.MatchedBy(func(ctx context.Context) bool { return true })
+	policy := RetryPolicy{initialDelay: time.Millisecond, maxDelay: time.Millisecond * 4, maxDuration: time.Second}
+
+	first := kafka.Message{Key: []byte("2030-10")}
+	second := kafka.Message{Key: []byte("2030-11")}
+	third := kafka.Message{Key: []byte("2030-12")}
+
+	t.Run("retry temporary error", func(t *testing.T) {
+		var out bytes.Buffer
+
+		writer := mocks.NewWriterInterface(t)
+		writer.On("WriteMessages", matchContext, first, second).Return(kafka.LeaderNotAvailable).Twice()
+		writer.On("WriteMessages", matchContext, first, second).Return(nil).Once()
+
+		err := NewRetryingWriter(writer, policy, &out).WriteMessages(context.Background(), first, second)
+
+		assert.NoError(t, err)
+		writer.AssertNumberOfCalls(t, "WriteMessages", 3)
+		assert.Contains(t, out.String(), "Write of 2 messages failed (attempt 2): [5] Leader Not Available")
+	})
+
+	t.Run("retry only failed messages", func(t *testing.T) {
+		writer := mocks.NewWriterInterface(t)
+		writer.On("WriteMessages", matchContext, first, second, third).
+			Return(kafka.WriteErrors{nil, kafka.NotLeaderForPartition, kafka.RequestTimedOut}).Once()
+		writer.On("WriteMessages", matchContext, second, third).
+			Return(kafka.WriteErrors{nil, kafka.RequestTimedOut}).Once()
+		writer.On("WriteMessages", matchContext, third).Return(nil).Once()
+
+		err := NewRetryingWriter(writer, policy, io.Discard).WriteMessages(context.Background(), first, second, third)
+
+		assert.NoError(t, err)
+		writer.AssertExpectations(t)
+	})
+
+	t.Run("not retryable error", func(t *testing.T) {
+		writer := mocks.NewWriterInterface(t)
+		writer.On("WriteMessages", matchContext, first).Return(kafka.MessageSizeTooLarge).Once()
+
+		err := NewRetryingWriter(writer, policy, io.Discard).WriteMessages(context.Background(), first)
+
+		assert.Equal(t, kafka.MessageSizeTooLarge, err)
+	})
+
+	t.Run("message larger than writer batch bytes is not retried", func(t *testing.T) {
+		tooLargeError := kafka.MessageTooLargeError{Message: first}
+		writer := mocks.NewWriterInterface(t)
+		writer.On("WriteMessages", matchContext, first).Return(tooLargeError).Once()
+
+		err := NewRetryingWriter(writer, policy, io.Discard).WriteMessages(context.Background(), first)
+
+		assert.Equal(t, tooLargeError, err)
+	})
+
+	t.Run("max duration exceeded", func(t *testing.T) {
+		expectedError := errors.New("connection refused")
+
+		writer := mocks.NewWriterInterface(t)
+		writer.On("WriteMessages", matchContext, first).Return(expectedError)
+
+		shortPolicy := RetryPolicy{initialDelay: time.Millisecond * 10, maxDelay: time.Millisecond * 20, maxDuration: time.Millisecond * 50}
+		err := NewRetryingWriter(writer, shortPolicy, io.Discard).WriteMessages(context.Background(), first)
+
+		assert.ErrorIs(t, err, expectedError)
+		assert.Regexp(t, `^write failed after \d+ attempts: connection refused$`, err.Error())
+	})
+
+	t.Run("cancelled while waiting retry", func(t *testing.T) {
+		writer := mocks.NewWriterInterface(t)
+		writer.On("WriteMessages", matchContext, first).Return(kafka.LeaderNotAvailable).Once()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(time.Millisecond*20, cancel)
+
+		slowPolicy := RetryPolicy{initialDelay: time.Minute, maxDelay: time.Minute, maxDuration: time.Hour}
+		err := NewRetryingWriter(writer, slowPolicy, io.Discard).WriteMessages(ctx, first)
+
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		writer := mocks.NewWriterInterface(t)
+		writer.On("Close").Return(nil).Once()
+
+		assert.NoError(t, NewRetryingWriter(writer, policy, io.Discard).Close())
+	})
+}
+
+func TestWithRetries(t *testing.T) {
+	writer := mocks.NewWriterInterface(t)
+
+	assert.Same(t, writer, withRetries(writer, RetryPolicy{}, io.Discard))
+	assert.IsType(t, &RetryingWriter{}, withRetries(writer, RetryPolicy{maxDuration: time.Second}, io.Discard))
+}
+
+func TestIsRetryableWriteError(t *testing.T) {
+	assert.True(t, isRetryableWriteError(errors.New("connection refused")))
+	assert.True(t, isRetryableWriteError(kafka.LeaderNotAvailable))
+	assert.True(t, isRetryableWriteError(kafka.WriteErrors{nil, kafka.RequestTimedOut}))
+	assert.False(t, isRetryableWriteError(kafka.WriteErrors{kafka.MessageSizeTooLarge, kafka.RequestTimedOut}))
+	assert.False(t, isRetryableWriteError(kafka.WriteErrors{nil}))
+	assert.False(t, isRetryableWriteError(kafka.TopicAuthorizationFailed))
+	assert.False(t, isRetryableWriteError(context.Canceled))
+	assert.False(t, isRetryableWriteError(kafka.MessageTooLargeError{Message: kafka.Message{Value: []byte("large")}}))
+	assert.False(t, isRetryableWriteError(fmt.Errorf("sink kafka: %w", kafka.MessageTooLargeError{})))
+	assert.False(t, isRetryableWriteError(io.ErrClosedPipe))
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/segmentio/kafka-go"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	JsonlFileFormat = "jsonl"
+	CsvFileFormat   = "csv"
+)
+
+var csvFileHeader = []string{"time", "key", "headers", "value"}
+
+// RotatingFileWriter is events.WriterInterface which appends messages to JSON lines or CSV file;
+// when the file would exceed maxBytes, it is renamed with timestamp suffix and a new one is started.
+type RotatingFileWriter struct {
+	filename string
+	format   string
+	maxBytes int64
+	file     *os.File
+	size     int64
+	mutex    sync.Mutex
+}
+
+func NewRotatingFileWriter(filename string, format string, maxBytes int64) (*RotatingFileWriter, error) {
+	writer := &RotatingFileWriter{
+		filename: filename,
+		format:   format,
+		maxBytes: maxBytes,
+	}
+
+	return writer, writer.open()
+}
+
+func (writer *RotatingFileWriter) open() (err error) {
+	writer.file, err = os.OpenFile(writer.filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+
+	stat, err := writer.file.Stat()
+	if err != nil {
+		return
+	}
+
+	writer.size = stat.Size()
+	if writer.size == 0 && writer.format == CsvFileFormat {
+		err = writer.write(encodeCsvRow(csvFileHeader))
+	}
+
+	return
+}
+
+func (writer *RotatingFileWriter) write(content []byte) error {
+	written, err := writer.file.Write(content)
+	writer.size += int64(written)
+
+	return err
+}
+
+func (writer *RotatingFileWriter) rotate() error {
+	if err := writer.file.Close(); err != nil {
+		return err
+	}
+
+	// rotations within the same microsecond should not overwrite each other
+	rotated := rotatedFilename(writer.filename, time.Now())
+	for i := 1; fileExists(rotated); i++ {
+		rotated = rotatedFilename(writer.filename, time.Now()) + "." + strconv.Itoa(i)
+	}
+
+	if err := os.Rename(writer.filename, rotated); err != nil {
+		return err
+	}
+
+	return writer.open()
+}
+
+func (writer *RotatingFileWriter) encode(message kafka.Message) []byte {
+	record := newJsonlRecord(message)
+	if writer.format == CsvFileFormat {
+		var headers, value string
+		if len(record.Headers) != 0 {
+			encoded, _ := json.Marshal(record.Headers)
+			headers = string(encoded)
+		}
+		if message.Value != nil {
+			value = string(message.Value)
+		}
+
+		return encodeCsvRow([]string{record.Time.Format(time.RFC3339Nano), record.Key, headers, value})
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(record)
+
+	return buffer.Bytes()
+}
+
+func (writer *RotatingFileWriter) WriteMessages(_ context.Context, messages ...kafka.Message) error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	for _, message := range messages {
+		content := writer.encode(message)
+		if writer.maxBytes != 0 && writer.size != 0 && writer.size+int64(len(content)) > writer.maxBytes {
+			if err := writer.rotate(); err != nil {
+				return err
+			}
+		}
+
+		if err := writer.write(content); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (writer *RotatingFileWriter) Close() error {
+	return writer.file.Close()
+}
+
+func encodeCsvRow(row []string) []byte {
+	var buffer bytes.Buffer
+	csvWriter := csv.NewWriter(&buffer)
+	_ = csvWriter.Write(row)
+	csvWriter.Flush()
+
+	return buffer.Bytes()
+}
+
+// rotatedFilename inserts timestamp before file extension: disciplines.jsonl -> disciplines.20230305T040000.000000.jsonl
+func rotatedFilename(filename string, now time.Time) string {
+	extension := filepath.Ext(filename)
+
+	return strings.TrimSuffix(filename, extension) + "." + now.Format("20060102T150405.000000") + extension
+}
+
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileWriter(t *testing.T) {
+	messageTime := time.Date(2023, 3, 5, 4, 0, 0, 0, time.UTC)
+	messages := []kafka.Message{
+		{
+			Key:     []byte("2030-10"),
+			Value:   []byte(`{"Id":10,"Name":"Право, ЄС","Year":2030}`),
+			Headers: []kafka.Header{{Key: EventNameHeader, Value: []byte("DisciplineEvent")}},
+			Time:    messageTime,
+		},
+		{
+			Key:  []byte("2030-11"),
+			Time: messageTime,
+		},
+	}
+
+	t.Run("jsonl", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "disciplines.jsonl")
+
+		writer, err := NewRotatingFileWriter(filename, JsonlFileFormat, 0)
+		assert.NoError(t, err)
+		assert.NoError(t, writer.WriteMessages(context.Background(), messages...))
+		assert.NoError(t, writer.Close())
+
+		content, _ := os.ReadFile(filename)
+		assert.Equal(
+			t,
+			`{"time":"2023-03-05T04:00:00Z","key":"2030-10","headers":{"event":"DisciplineEvent"},"value":{"Id":10,"Name":"Право, ЄС","Year":2030}}`+"\n"+
+				`{"time":"2023-03-05T04:00:00Z","key":"2030-11","value":null}`+"\n",
+			string(content),
+		)
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "disciplines.csv")
+
+		writer, err := NewRotatingFileWriter(filename, CsvFileFormat, 0)
+		assert.NoError(t, err)
+		assert.NoError(t, writer.WriteMessages(context.Background(), messages[0]))
+		assert.NoError(t, writer.Close())
+
+		writer, err = NewRotatingFileWriter(filename, CsvFileFormat, 0)
+		assert.NoError(t, err)
+		assert.NoError(t, writer.WriteMessages(context.Background(), messages[1]))
+		assert.NoError(t, writer.Close())
+
+		content, _ := os.ReadFile(filename)
+		assert.Equal(
+			t,
+			"time,key,headers,value\n"+
+				`2023-03-05T04:00:00Z,2030-10,"{""event"":""DisciplineEvent""}","{""Id"":10,""Name"":""Право, ЄС"",""Year"":2030}"`+"\n"+
+				"2023-03-05T04:00:00Z,2030-11,,\n",
+			string(content),
+		)
+	})
+
+	t.Run("rotate", func(t *testing.T) {
+		dir := t.TempDir()
+		filename := filepath.Join(dir, "disciplines.jsonl")
+
+		writer, err := NewRotatingFileWriter(filename, JsonlFileFormat, 100)
+		assert.NoError(t, err)
+		assert.NoError(t, writer.WriteMessages(context.Background(), messages...))
+		assert.NoError(t, writer.WriteMessages(context.Background(), messages...))
+		assert.NoError(t, writer.Close())
+
+		rotated, _ := filepath.Glob(filepath.Join(dir, "disciplines.*"))
+		assert.Len(t, rotated, 4)
+
+		content, _ := os.ReadFile(filename)
+		assert.Equal(t, `{"time":"2023-03-05T04:00:00Z","key":"2030-11","value":null}`+"\n", string(content))
+	})
+}
+
+func TestRotatedFilename(t *testing.T) {
+	now := time.Date(2023, 3, 5, 4, 0, 0, 123456000, time.UTC)
+
+	assert.Equal(t, "/var/disciplines.20230305T040000.123456.jsonl", rotatedFilename("/var/disciplines.jsonl", now))
+	assert.Equal(t, "disciplines.20230305T040000.123456", rotatedFilename("disciplines", now))
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/kneu-messenger-pigeon/events"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	KafkaSink   = "kafka"
+	FileSink    = "file"
+	StdoutSink  = "stdout"
+	WebhookSink = "webhook"
+)
+
+var sinkKinds = []string{KafkaSink, FileSink, StdoutSink, WebhookSink}
+
+// SinkConfig describes where discipline events are published.
+type SinkConfig struct {
+	kind   string
+	policy string
+	// kafka sink
+	kafkaTopic string
+	// file sink
+	file         string
+	fileFormat   string
+	fileMaxBytes int64
+	// webhook sink
+	webhookUrl           string
+	webhookAuthorization string
+	webhookBatchSize     int
+	webhookAttempts      int
+	webhookTimeout       time.Duration
+}
+
+// loadSinkConfigs reads comma separated OUTPUT_SINKS (or single OUTPUT_SINK) with OUTPUT_<SINK>_POLICY of each one.
+func loadSinkConfigs(source *ConfigSource, kafkaTopic string) ([]SinkConfig, error) {
+	var problems ConfigProblems
+	var err error
+
+	base := SinkConfig{
+		kafkaTopic: kafkaTopic,
+		file:       source.get("OUTPUT_FILE"),
+		fileFormat: source.getOrDefault("OUTPUT_FILE_FORMAT", JsonlFileFormat),
+	}
+
+	base.webhookUrl, err = source.secret("OUTPUT_WEBHOOK_URL")
+	problems.add(err)
+
+	base.webhookAuthorization, err = source.secret("OUTPUT_WEBHOOK_AUTHORIZATION")
+	problems.add(err)
+
+	fileMaxBytes, err := source.int("OUTPUT_FILE_MAX_BYTES", 0, 0)
+	base.fileMaxBytes = int64(fileMaxBytes)
+	problems.add(err)
+
+	base.webhookBatchSize, err = source.int("OUTPUT_WEBHOOK_BATCH_SIZE", 100, 1)
+	problems.add(err)
+
+	base.webhookAttempts, err = source.int("OUTPUT_WEBHOOK_ATTEMPTS", 3, 1)
+	problems.add(err)
+
+	base.webhookTimeout, err = source.timeout("OUTPUT_WEBHOOK_TIMEOUT", time.Second*10)
+	problems.add(err)
+
+	kinds := source.getOrDefault("OUTPUT_SINKS", source.getOrDefault("OUTPUT_SINK", KafkaSink))
+
+	// policies of not listed sinks are read too, so they are known settings of config file
+	policies := map[string]string{}
+	for _, kind := range sinkKinds {
+		policies[kind] = source.get(sinkPolicyEnv(kind))
+	}
+
+	var configs []SinkConfig
+	for _, kind := range strings.Split(kinds, ",") {
+		config := base
+		config.kind = strings.TrimSpace(kind)
+		if slices.ContainsFunc(configs, func(previous SinkConfig) bool { return previous.kind == config.kind }) {
+			problems.add(fmt.Errorf("wrong OUTPUT_SINKS: sink %q is listed several times", config.kind))
+			continue
+		}
+
+		if err = config.validate(); err != nil {
+			problems.add(err)
+			continue
+		}
+
+		config.policy, err = parseSinkPolicy(policies[config.kind])
+		problems.add(prefixError("wrong "+sinkPolicyEnv(config.kind)+": ", err))
+
+		configs = append(configs, config)
+	}
+
+	if err = problems.err(); err != nil {
+		return nil, err
+	}
+
+	return configs, nil
+}
+
+func sinkPolicyEnv(kind string) string {
+	return "OUTPUT_" + strings.ToUpper(kind) + "_POLICY"
+}
+
+func (config SinkConfig) validate() error {
+	switch config.kind {
+	case KafkaSink, StdoutSink:
+		return nil
+
+	case FileSink:
+		if config.file == "" {
+			return errors.New("empty OUTPUT_FILE: required by file sink")
+		}
+		if config.fileFormat != JsonlFileFormat && config.fileFormat != CsvFileFormat {
+			return fmt.Errorf("wrong OUTPUT_FILE_FORMAT: unknown format %q, expected jsonl or csv", config.fileFormat)
+		}
+
+	case WebhookSink:
+		if config.webhookUrl == "" {
+			return errors.New("empty OUTPUT_WEBHOOK_URL: required by webhook sink")
+		}
+		if parsed, err := url.Parse(config.webhookUrl); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return errors.New("wrong OUTPUT_WEBHOOK_URL: expected http or https URL")
+		}
+
+	default:
+		return fmt.Errorf("wrong OUTPUT_SINKS: unknown sink %q, expected one of: %s", config.kind, strings.Join(sinkKinds, ", "))
+	}
+
+	return nil
+}
+
+// newSinkWriter creates writer of discipline events; stdout sink writes into out, failures are logged into logOut.
+func newSinkWriter(
+	config SinkConfig, kafkaBrokers []string, producer ProducerConfig, out io.Writer, logOut io.Writer, batch BatchPolicy,
+) (events.WriterInterface, error) {
+	switch config.kind {
+	case FileSink:
+		return NewRotatingFileWriter(config.file, config.fileFormat, config.fileMaxBytes)
+
+	case StdoutSink:
+		return NewJsonlWriter(out), nil
+
+	case WebhookSink:
+		return NewWebhookWriter(
+			config.webhookUrl, config.webhookAuthorization,
+			config.webhookBatchSize, config.webhookAttempts, config.webhookTimeout,
+		), nil
+	}
+
+	// importer batch counts message size the same way as kafka.Writer, so it is written as single kafka.Writer batch
+	writer := producer.newWriter(kafkaBrokers, config.kafkaTopic, logOut)
+	writer.BatchSize = batch.maxCount
+	if batch.maxBytes != 0 {
+		writer.BatchBytes = int64(batch.maxBytes)
+	}
+
+	return writer, nil
+}
+
+// newSinksWriter creates writer of every sink; several sinks or not required one are wrapped into FanoutWriter.
+// Required sinks except webhook, which retries requests itself, are wrapped into RetryingWriter; FanoutWriter waits
+// for every sink, so others fail at once not to hold up the import, buffered ones retry with the next batch.
+// spillKafka, when it is not nil, wraps Kafka sink into outbox, so spilled batches are not written into other
+// sinks twice.
+func newSinksWriter(
+	configs []SinkConfig, kafkaBrokers []string, producer ProducerConfig,
+	out io.Writer, logOut io.Writer, retry RetryPolicy, batch BatchPolicy,
+	spillKafka func(writer events.WriterInterface) (events.WriterInterface, error),
+) (events.WriterInterface, error) {
+	sinks := make([]*FanoutSink, 0, len(configs))
+	for _, config := range configs {
+		writer, err := newSinkWriter(config, kafkaBrokers, producer, out, logOut, batch)
+		if err == nil && config.kind != WebhookSink && config.policy == RequiredSinkPolicy {
+			writer = withRetries(writer, retry, logOut)
+		}
+		if err == nil && config.kind == KafkaSink && spillKafka != nil {
+			var spilling events.WriterInterface
+			if spilling, err = spillKafka(writer); err != nil {
+				_ = writer.Close()
+			}
+			writer = spilling
+		}
+		if err != nil {
+			for _, sink := range sinks {
+				_ = sink.writer.Close()
+			}
+			return nil, fmt.Errorf("sink %s: %w", config.kind, err)
+		}
+
+		sinks = append(sinks, &FanoutSink{name: config.kind, policy: config.policy, writer: writer})
+	}
+
+	if len(sinks) == 1 && sinks[0].policy == RequiredSinkPolicy {
+		return sinks[0].writer, nil
+	}
+
+	return NewFanoutWriter(logOut, sinks...), nil
+}
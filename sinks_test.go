@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/kneu-messenger-pigeon/events"
+	"github.com/kneu-messenger-pigeon/events/mocks"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSinkConfigValidate(t *testing.T) {
+	testCases := map[string]SinkConfig{
+		"": {kind: KafkaSink},
+		"empty OUTPUT_FILE: required by file sink":           {kind: FileSink, fileFormat: JsonlFileFormat},
+		"empty OUTPUT_WEBHOOK_URL: required by webhook sink": {kind: WebhookSink},
+		"wrong OUTPUT_FILE_FORMAT: unknown format \"xml\", expected jsonl or csv": {
+			kind: FileSink, file: "disciplines.xml", fileFormat: "xml",
+		},
+		"wrong OUTPUT_WEBHOOK_URL: expected http or https URL": {kind: WebhookSink, webhookUrl: "ftp://example.com"},
+	}
+
+	for expectedError, config := range testCases {
+		err := config.validate()
+		if expectedError == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, expectedError)
+		}
+	}
+}
+
+func TestNewSinkWriter(t *testing.T) {
+	var out bytes.Buffer
+	var logOut bytes.Buffer
+
+	producer := ProducerConfig{compression: kafka.Zstd, requiredAcks: kafka.RequireAll, balancer: HashBalancer}
+	writer, err := newSinkWriter(
+		SinkConfig{kind: KafkaSink, kafkaTopic: "staging.disciplines"}, []string{"KAFKA:9999"}, producer, &out, &logOut,
+		BatchPolicy{maxCount: 100, maxBytes: 5000},
+	)
+	assert.NoError(t, err)
+	assert.IsType(t, &kafka.Writer{}, writer)
+	assert.Equal(t, "staging.disciplines", writer.(*kafka.Writer).Topic)
+	assert.Equal(t, kafka.Zstd, writer.(*kafka.Writer).Compression)
+	assert.Equal(t, kafka.RequireAll, writer.(*kafka.Writer).RequiredAcks)
+	assert.IsType(t, &kafka.Hash{}, writer.(*kafka.Writer).Balancer)
+	assert.Equal(t, 100, writer.(*kafka.Writer).BatchSize)
+	assert.Equal(t, int64(5000), writer.(*kafka.Writer).BatchBytes)
+
+	writer, err = newSinkWriter(SinkConfig{kind: StdoutSink}, nil, ProducerConfig{}, &out, &logOut, BatchPolicy{maxCount: 100})
+	assert.NoError(t, err)
+	assert.Same(t, &out, writer.(*JsonlWriter).out)
+
+	writer, err = newSinkWriter(
+		SinkConfig{kind: WebhookSink, webhookUrl: "http://localhost", webhookBatchSize: 10}, nil, ProducerConfig{}, &out, &logOut, BatchPolicy{},
+	)
+	assert.NoError(t, err)
+	assert.IsType(t, &WebhookWriter{}, writer)
+
+	writer, err = newSinkWriter(
+		SinkConfig{kind: FileSink, file: filepath.Join(t.TempDir(), "disciplines.csv"), fileFormat: CsvFileFormat}, nil, ProducerConfig{}, &out, &logOut, BatchPolicy{},
+	)
+	assert.NoError(t, err)
+	assert.IsType(t, &RotatingFileWriter{}, writer)
+	assert.NoError(t, writer.Close())
+
+	writer, err = newSinkWriter(
+		SinkConfig{kind: FileSink, file: filepath.Join(t.TempDir(), "not-exists", "disciplines.csv")}, nil, ProducerConfig{}, &out, &logOut, BatchPolicy{},
+	)
+	assert.Error(t, err)
+}
+
+func TestNewSinksWriter(t *testing.T) {
+	var out bytes.Buffer
+	var logOut bytes.Buffer
+
+	writer, err := newSinksWriter(
+		[]SinkConfig{{kind: StdoutSink, policy: RequiredSinkPolicy}}, nil, ProducerConfig{}, &out, &logOut, RetryPolicy{}, BatchPolicy{}, nil,
+	)
+	assert.NoError(t, err)
+	assert.Same(t, &out, writer.(*JsonlWriter).out, "stdout sink writes into out, not into log")
+
+	writer, err = newSinksWriter(
+		[]SinkConfig{{kind: KafkaSink, policy: RequiredSinkPolicy}, {kind: StdoutSink, policy: BestEffortSinkPolicy}},
+		[]string{"KAFKA:9999"}, ProducerConfig{}, &out, &logOut, RetryPolicy{}, BatchPolicy{}, nil,
+	)
+	assert.NoError(t, err)
+	assert.IsType(t, &FanoutWriter{}, writer)
+	assert.Len(t, writer.(*FanoutWriter).sinks, 2)
+	assert.Equal(t, "stdout", writer.(*FanoutWriter).sinks[1].name)
+	assert.Equal(t, BestEffortSinkPolicy, writer.(*FanoutWriter).sinks[1].policy)
+
+	writer, err = newSinksWriter(
+		[]SinkConfig{
+			{kind: StdoutSink, policy: RequiredSinkPolicy},
+			{kind: FileSink, policy: RequiredSinkPolicy, file: filepath.Join(t.TempDir(), "not-exists", "disciplines.csv")},
+		},
+		nil, ProducerConfig{}, &out, &logOut, RetryPolicy{}, BatchPolicy{}, nil,
+	)
+	assert.ErrorContains(t, err, "sink file: open ")
+	assert.Nil(t, writer)
+
+	retry := RetryPolicy{initialDelay: time.Millisecond, maxDelay: time.Second, maxDuration: time.Minute}
+	writer, err = newSinksWriter(
+		[]SinkConfig{
+			{kind: KafkaSink, policy: RequiredSinkPolicy},
+			{kind: WebhookSink, policy: BufferedSinkPolicy, webhookUrl: "http://localhost", webhookBatchSize: 10},
+		},
+		[]string{"KAFKA:9999"}, ProducerConfig{}, &out, &logOut, retry, BatchPolicy{}, nil,
+	)
+	assert.NoError(t, err)
+	assert.IsType(t, &RetryingWriter{}, writer.(*FanoutWriter).sinks[0].writer)
+	assert.Equal(t, retry, writer.(*FanoutWriter).sinks[0].writer.(*RetryingWriter).policy)
+	assert.IsType(t, &WebhookWriter{}, writer.(*FanoutWriter).sinks[1].writer)
+}
+
+func TestNewSinksWriterSpillKafka(t *testing.T) {
+	var out bytes.Buffer
+	var logOut bytes.Buffer
+	matchContext := mock.MatchedBy(func(ctx context.Context) bool { return true })
+	message := kafka.Message{Key: []byte("key"), Value: []byte(`{"Id":1}`)}
+
+	// Kafka sink is replaced by mock, which fails by temporary error once
+	kafkaWriter := mocks.NewWriterInterface(t)
+	kafkaWriter.On("WriteMessages", matchContext, message).Return(kafka.LeaderNotAvailable).Once()
+	kafkaWriter.On("WriteMessages", matchContext, message).Return(nil).Once()
+	kafkaWriter.On("Close").Return(nil)
+
+	var outbox *Outbox
+	writer, err := newSinksWriter(
+		[]SinkConfig{{kind: KafkaSink, policy: RequiredSinkPolicy}, {kind: StdoutSink, policy: RequiredSinkPolicy}},
+		[]string{"KAFKA:9999"}, ProducerConfig{}, &out, &logOut, RetryPolicy{}, BatchPolicy{},
+		func(writer events.WriterInterface) (events.WriterInterface, error) {
+			_ = writer.Close()
+			var err error
+			outbox, err = NewOutbox(t.TempDir(), kafkaWriter, time.Hour, &logOut)
+			return outbox, err
+		},
+	)
+	assert.NoError(t, err)
+	assert.Same(t, outbox, writer.(*FanoutWriter).sinks[0].writer)
+	assert.IsType(t, &JsonlWriter{}, writer.(*FanoutWriter).sinks[1].writer)
+
+	assert.NoError(t, writer.WriteMessages(context.Background(), message))
+	assert.NoError(t, outbox.flush(context.Background()))
+	assert.NoError(t, writer.Close())
+
+	assert.Equal(t, 1, strings.Count(out.String(), `"key":"key"`), "spilled batch is not written into stdout again")
+	kafkaWriter.AssertNumberOfCalls(t, "WriteMessages", 2)
+}
+
+func TestNewSinksWriterFailingBestEffortSink(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("/dev/full is required to emulate full disk")
+	}
+
+	var out bytes.Buffer
+	var logOut bytes.Buffer
+
+	retry := RetryPolicy{initialDelay: time.Millisecond * 100, maxDelay: time.Second, maxDuration: time.Second * 2}
+	writer, err := newSinksWriter(
+		[]SinkConfig{
+			{kind: StdoutSink, policy: RequiredSinkPolicy},
+			{kind: FileSink, policy: BestEffortSinkPolicy, file: "/dev/full", fileFormat: JsonlFileFormat},
+		},
+		nil, ProducerConfig{}, &out, &logOut, retry, BatchPolicy{}, nil,
+	)
+	assert.NoError(t, err)
+
+	startedAt := time.Now()
+	err = writer.WriteMessages(context.Background(), kafka.Message{Key: []byte("key"), Value: []byte(`{"Id":1}`)})
+
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(startedAt), retry.initialDelay, "failed best-effort sink is not retried")
+	assert.Contains(t, out.String(), `"key":"key"`)
+	assert.Contains(t, logOut.String(), "Sink file (best-effort) failed: ")
+}
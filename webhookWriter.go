@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"io"
+	"net/http"
+	"time"
+)
+
+// WebhookRetryDelay is delay before the second attempt, it is doubled for each next one.
+const WebhookRetryDelay = time.Second
+
+// WebhookWriter is events.WriterInterface which POSTs messages as JSON array of JsonlRecord in batches.
+// Batch is retried on network errors, 429 and 5xx responses.
+type WebhookWriter struct {
+	url           string
+	authorization string
+	batchSize     int
+	attempts      int
+	retryDelay    time.Duration
+	client        *http.Client
+}
+
+func NewWebhookWriter(url string, authorization string, batchSize int, attempts int, timeout time.Duration) *WebhookWriter {
+	return &WebhookWriter{
+		url:           url,
+		authorization: authorization,
+		batchSize:     batchSize,
+		attempts:      attempts,
+		retryDelay:    WebhookRetryDelay,
+		client:        &http.Client{Timeout: timeout},
+	}
+}
+
+func (writer *WebhookWriter) WriteMessages(ctx context.Context, messages ...kafka.Message) error {
+	for start := 0; start < len(messages); start += writer.batchSize {
+		end := min(start+writer.batchSize, len(messages))
+
+		records := make([]JsonlRecord, 0, end-start)
+		for _, message := range messages[start:end] {
+			records = append(records, newJsonlRecord(message))
+		}
+
+		body, err := json.Marshal(records)
+		if err == nil {
+			err = writer.post(ctx, body)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (writer *WebhookWriter) post(ctx context.Context, body []byte) (err error) {
+	delay := writer.retryDelay
+	retryable := true
+	for attempt := 1; retryable; attempt++ {
+		retryable, err = writer.send(ctx, body)
+		if err == nil || !retryable || attempt >= writer.attempts {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+			delay *= 2
+		}
+	}
+
+	return
+}
+
+// send makes single POST request and returns whether failed request could be retried.
+func (writer *WebhookWriter) send(ctx context.Context, body []byte) (bool, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, writer.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	if writer.authorization != "" {
+		request.Header.Set("Authorization", writer.authorization)
+	}
+
+	response, err := writer.client.Do(request)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	_, _ = io.Copy(io.Discard, response.Body)
+	_ = response.Body.Close()
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return false, nil
+	}
+
+	err = fmt.Errorf("webhook responded with status %s", response.Status)
+	return response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500, err
+}
+
+func (writer *WebhookWriter) Close() error {
+	writer.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookWriter(t *testing.T) {
+	messages := []kafka.Message{
+		{Key: []byte("2030-10"), Value: []byte(`{"Id":10,"Name":"name 10","Year":2030}`)},
+		{Key: []byte("2030-11"), Value: []byte(`{"Id":11,"Name":"name 11","Year":2030}`)},
+		{Key: []byte("2030-12"), Value: []byte(`{"Id":12,"Name":"name 12","Year":2030}`)},
+	}
+
+	newServer := func(statuses ...int) (*httptest.Server, *[][]JsonlRecord) {
+		var batches [][]JsonlRecord
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+
+			var batch []JsonlRecord
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+			batches = append(batches, batch)
+
+			status := http.StatusOK
+			if len(batches) <= len(statuses) {
+				status = statuses[len(batches)-1]
+			}
+			w.WriteHeader(status)
+		}))
+
+		return server, &batches
+	}
+
+	t.Run("batches", func(t *testing.T) {
+		server, batches := newServer()
+		defer server.Close()
+
+		writer := NewWebhookWriter(server.URL, "Bearer secret", 2, 3, time.Second)
+		assert.NoError(t, writer.WriteMessages(context.Background(), messages...))
+		assert.NoError(t, writer.Close())
+
+		assert.Len(t, *batches, 2)
+		assert.Len(t, (*batches)[0], 2)
+		assert.Equal(t, "2030-12", (*batches)[1][0].Key)
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		server, batches := newServer(http.StatusServiceUnavailable, http.StatusTooManyRequests)
+		defer server.Close()
+
+		writer := NewWebhookWriter(server.URL, "Bearer secret", 10, 3, time.Second)
+		writer.retryDelay = time.Millisecond
+		assert.NoError(t, writer.WriteMessages(context.Background(), messages...))
+
+		assert.Len(t, *batches, 3)
+	})
+
+	t.Run("attempts exceeded", func(t *testing.T) {
+		server, batches := newServer(http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+		defer server.Close()
+
+		writer := NewWebhookWriter(server.URL, "Bearer secret", 10, 2, time.Second)
+		writer.retryDelay = time.Millisecond
+		err := writer.WriteMessages(context.Background(), messages...)
+
+		assert.EqualError(t, err, "webhook responded with status 502 Bad Gateway")
+		assert.Len(t, *batches, 2)
+	})
+
+	t.Run("not retryable status", func(t *testing.T) {
+		server, batches := newServer(http.StatusBadRequest)
+		defer server.Close()
+
+		writer := NewWebhookWriter(server.URL, "Bearer secret", 10, 3, time.Second)
+		err := writer.WriteMessages(context.Background(), messages...)
+
+		assert.EqualError(t, err, "webhook responded with status 400 Bad Request")
+		assert.Len(t, *batches, 1)
+	})
+
+	t.Run("cancelled while waiting retry", func(t *testing.T) {
+		server, _ := newServer(http.StatusServiceUnavailable)
+		defer server.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		writer := NewWebhookWriter(server.URL, "Bearer secret", 10, 3, time.Second)
+		writer.retryDelay = time.Minute
+		time.AfterFunc(time.Millisecond*50, cancel)
+
+		assert.ErrorIs(t, writer.WriteMessages(ctx, messages...), context.Canceled)
+	})
+}